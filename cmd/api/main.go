@@ -5,10 +5,14 @@ import (
 	"net/http"
 	"time"
 
+	"aka-project/internal/admin"
 	"aka-project/internal/api"
+	"aka-project/internal/auth"
 	"aka-project/internal/config"
 	"aka-project/internal/db"
+	"aka-project/internal/health"
 	"aka-project/internal/helper"
+	"aka-project/internal/ipfilter"
 	"aka-project/internal/logger"
 	internal_middleware "aka-project/internal/middleware"
 	"aka-project/internal/repository"
@@ -16,6 +20,7 @@ import (
 
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
 	"github.com/go-chi/chi/v5"
@@ -23,34 +28,43 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
 
-	otlpmetricgrpc "go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 )
 
 func main() {
-	logger.New()
-	log.Info().Msg("Application starting...")
 	cfg := config.Load()
+	if err := logger.New(cfg.LogLevel); err != nil {
+		log.Warn().Err(err).Str("level", cfg.LogLevel).Msg("invalid LOG_LEVEL, using info")
+	}
+	log.Info().Msg("Application starting...")
 	ctx := context.Background()
 
 	// Telemetry
-	// Create OTLP metric exporter
-	metricExporter, err := otlpmetricgrpc.New(ctx)
+	mp, metricsHandler, err := telemetry.NewMeterProvider(ctx, cfg.MetricsExporter, cfg.OTELCollector)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to create OTLP metric exporter")
+		log.Fatal().Err(err).Msg("failed to create meter provider")
 	}
 
-	// Create MeterProvider with OTLP exporter
-	mp := metric.NewMeterProvider(
-		metric.WithReader(metric.NewPeriodicReader(metricExporter)),
-	)
+	var traceOpts []telemetry.Option
+	if cfg.OTELCollector != "" {
+		traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(cfg.OTELCollector))
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create OTLP trace exporter")
+		}
+		traceOpts = append(traceOpts, telemetry.WithSpanExporter(traceExporter))
+	}
+	traceOpts = append(traceOpts, telemetry.WithSampleRatio(cfg.TraceSampleRatio))
 
-	tele, err := telemetry.NewTelemetryWithMeterProvider("aka-project", mp)
+	tele, err := telemetry.NewTelemetryWithMeterProvider("aka-project", mp, traceOpts...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to init telemetry")
 	}
+	// The periodic reader exports every minute, so an error stays visible
+	// for two attempts.
+	exportStatus := &telemetry.ExportStatus{Window: 2 * time.Minute}
+	otel.SetErrorHandler(exportStatus)
 	defer func() {
 		// Flush metrics before shutdown
 		if err := mp.Shutdown(ctx); err != nil {
@@ -60,43 +74,245 @@ func main() {
 	}()
 
 	// Postgres
-	pool, err := pgxpool.New(ctx, cfg.DBUrl)
+	poolCfg, err := pgxpool.ParseConfig(cfg.DBUrl)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid DATABASE_URL")
+	}
+	poolCfg.ConnConfig.Tracer, err = telemetry.NewPgxTracer(tele.Meter, cfg.DBSlowQueryThreshold)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create query tracer")
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect db")
 	}
-	q := db.New(pool)
+	if err := telemetry.RegisterPoolMetrics(tele.Meter, pool); err != nil {
+		log.Fatal().Err(err).Msg("failed to register pool metrics")
+	}
+	q := db.NewStore(pool)
 
 	// Redis
 	redisClient := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+	if err := telemetry.InstrumentRedis(redisClient, tele.TracerProvider, mp); err != nil {
+		log.Fatal().Err(err).Msg("failed to instrument redis")
+	}
+
+	// API keys
+	apiKeyRepo := repository.NewAPIKeyRepo(q, redisClient, cfg.APIKeyCacheTTL)
+	if cfg.APIKey != "" {
+		if _, err := apiKeyRepo.EnsureKey(ctx, cfg.APIKey, "bootstrap", "API_KEY", cfg.APIKeyScopes, cfg.APIKeyPlan); err != nil {
+			log.Fatal().Err(err).Msg("failed to seed API_KEY")
+		}
+	}
+	subCtx, stopSubscriptions := context.WithCancel(ctx)
+	defer stopSubscriptions()
+	go apiKeyRepo.Subscribe(subCtx)
 
 	// Middleware
-	mw, err := internal_middleware.NewMiddleware(redisClient, cfg.RateLimitSpec, cfg.APIKey)
+	routeCosts := map[string]int64{}
+	for pattern, cost := range cfg.RateLimitRouteCosts {
+		n, err := strconv.ParseInt(cost, 10, 64)
+		if err != nil {
+			log.Fatal().Err(err).Str("route", pattern).Msg("invalid RATE_LIMIT_ROUTE_COSTS")
+		}
+		routeCosts[pattern] = n
+	}
+	quotas := map[string]repository.Quota{}
+	for plan, spec := range cfg.RateLimitQuotas {
+		q, err := repository.ParseQuota(spec)
+		if err != nil {
+			log.Fatal().Err(err).Str("plan", plan).Msg("invalid RATE_LIMIT_QUOTAS")
+		}
+		quotas[plan] = q
+	}
+	if cfg.UsageRollupInterval <= 0 {
+		log.Fatal().Dur("interval", cfg.UsageRollupInterval).Msg("USAGE_ROLLUP_INTERVAL must be positive")
+	}
+	usageRepo := repository.NewUsageRepo(q, redisClient)
+	go usageRepo.RunRollup(subCtx, cfg.UsageRollupInterval)
+
+	mw, err := internal_middleware.NewMiddleware(redisClient, cfg.RateLimitSpec, apiKeyRepo,
+		internal_middleware.WithPlans(cfg.RateLimitPlans, cfg.RateLimitDefaultPlan),
+		internal_middleware.WithRouteCosts(routeCosts),
+		internal_middleware.WithQuotas(usageRepo, quotas),
+		internal_middleware.WithFailureMode(cfg.RateLimitFailureMode),
+		internal_middleware.WithMeter(tele.Meter),
+	)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create middleware")
 	}
 
+	authenticators := []internal_middleware.Authenticator{mw.APIKeyAuth()}
+	if cfg.JWTJWKS != "" {
+		jwks, err := auth.NewJWKS(ctx, cfg.JWTJWKS, cfg.JWTJWKSRefresh)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load JWKS")
+		}
+		scopeMap, err := auth.ParseScopeMap(cfg.JWTScopeMap)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid JWT_SCOPE_MAP")
+		}
+		authenticators = append(authenticators, internal_middleware.JWTAuth(auth.NewJWTVerifier(jwks, auth.JWTConfig{
+			Issuer:      cfg.JWTIssuer,
+			Audience:    cfg.JWTAudience,
+			ScopeClaim:  cfg.JWTScopeClaim,
+			ScopeMap:    scopeMap,
+			TenantClaim: cfg.JWTTenantClaim,
+			Plan:        cfg.JWTPlan,
+			Leeway:      30 * time.Second,
+		})))
+	}
+
+	if cfg.HMACClientsFile != "" {
+		clients, err := auth.LoadHMACClients(cfg.HMACClientsFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load HMAC clients")
+		}
+		authenticators = append(authenticators, internal_middleware.NewHMACAuth(clients, redisClient, cfg.HMACMaxSkew))
+	}
+
 	// Repository + handlers
 	characterRepo := repository.NewCharacterRepo(q, helper.FetchPage)
 	characterHandler, err := api.NewCharacterHandler(characterRepo, tele.Meter)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create character handler")
 	}
-	healthHandler := &api.HealthHandler{DB: pool, Redis: redisClient}
+	characterWriteHandler := &api.CharacterWriteHandler{Repo: characterRepo}
+	collectionHandler := &api.CollectionHandler{Repo: repository.NewCollectionRepo(q, characterRepo)}
+	userHandler := &api.UserHandler{Repo: repository.NewUserRepo(q, characterRepo)}
+
+	// Health checks. Only Postgres and Redis take the pod out of rotation;
+	// the rest degrade individual features.
+	checks := health.NewRegistry(cfg.HealthCheckTimeout, cfg.HealthCheckCacheTTL)
+	checks.Register(health.Check{Name: "postgres", Critical: true, Checker: health.CheckerFunc(pool.Ping)})
+	checks.Register(health.Check{Name: "redis", Critical: true, Checker: health.CheckerFunc(func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	})})
+	// The upstream check outlasts the probe timeout, so it runs in the
+	// background and readiness reports its last result.
+	checks.Register(health.Check{
+		Name:    "upstream",
+		Checker: health.HTTPChecker{URL: cfg.RMAPI, Client: &http.Client{}},
+		Timeout: 3 * time.Second,
+		TTL:     30 * time.Second,
+	})
+	checks.Register(health.Check{Name: "sync", Checker: health.NewFreshnessChecker(characterRepo.LastSync, cfg.HealthSyncMaxAge)})
+	checks.Register(health.Check{Name: "otel_exporter", Checker: exportStatus})
+	healthHandler := &api.HealthHandler{Checks: checks}
+	plans := make([]string, 0, len(cfg.RateLimitPlans))
+	for name := range cfg.RateLimitPlans {
+		plans = append(plans, name)
+	}
+	apiKeyHandler := &api.APIKeyHandler{
+		Repo:          apiKeyRepo,
+		RotationGrace: cfg.APIKeyRotationGrace,
+		Plans:         plans,
+		DefaultPlan:   cfg.RateLimitDefaultPlan,
+	}
+	usageHandler := &api.UsageHandler{
+		Repo:        usageRepo,
+		Quotas:      quotas,
+		DefaultPlan: cfg.RateLimitDefaultPlan,
+	}
+
+	clientIP, err := internal_middleware.NewClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid TRUSTED_PROXIES")
+	}
+
+	// IP allow/deny rules; without a source every address is admitted.
+	ipFilter := func(string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	if cfg.IPRulesSource != "" {
+		var source ipfilter.Source = ipfilter.FileSource{Path: cfg.IPRulesSource}
+		if cfg.IPRulesSource == "postgres" {
+			source = ipfilter.DBSource{Queries: q}
+		}
+		filter, err := ipfilter.New(ctx, source, tele.Meter)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load ip rules")
+		}
+		go filter.Subscribe(subCtx, redisClient)
+		ipFilter = func(group string) func(http.Handler) http.Handler {
+			return internal_middleware.IPFilter(filter, group)
+		}
+	}
+
+	httpMetrics, err := internal_middleware.NewHTTPMetrics(tele.Meter)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create http metrics")
+	}
 
 	// Router
 	r := chi.NewRouter()
-	r.Use(middleware.RequestID, middleware.RealIP, internal_middleware.Logger)
+	r.Use(internal_middleware.Tracing, httpMetrics.Middleware, middleware.RequestID, clientIP.Middleware, internal_middleware.Logger)
 
-	r.Get("/healthcheck", healthHandler.Check)
+	r.Get("/livez", healthHandler.Live)
+	r.Get("/readyz", healthHandler.Ready)
+	r.Get("/startupz", healthHandler.Startup)
+	// Kept for clients that predate the split probes.
+	r.Get("/healthcheck", healthHandler.Ready)
 
 	r.Group(func(r chi.Router) {
-		r.Use(mw.RequireAPIKey)
+		r.Use(ipFilter("api"))
+		r.Use(internal_middleware.RequireAuth(authenticators...))
+		r.Use(internal_middleware.DebugLog(cfg.DebugLogSecret))
 		r.Use(mw.RateLimit)
+		r.Use(mw.EnforceQuota)
+		r.Use(internal_middleware.Idempotency(redisClient, cfg.IdempotencyTTL))
 
-		r.Get("/characters", otelhttp.NewHandler(
-			http.HandlerFunc(characterHandler.GetCharacters),
-			"CreateCharacters",
-		).ServeHTTP)
+		r.With(internal_middleware.RequireScope(auth.ScopeCharactersRead)).Get("/characters", characterHandler.GetCharacters)
+		r.Group(func(r chi.Router) {
+			r.Use(internal_middleware.RequireScope(auth.ScopeCharactersWrite))
+			r.Post("/characters", characterWriteHandler.Create)
+			r.Patch("/characters/{id}", characterWriteHandler.Patch)
+			r.Delete("/characters/{id}", characterWriteHandler.Delete)
+		})
+
+		// Routes in this group are registered flat rather than with
+		// r.Route: the middleware above runs before a subrouter resolves,
+		// so it would only see "/collections/*" when labelling requests and
+		// looking up RATE_LIMIT_ROUTE_COSTS.
+		r.With(internal_middleware.RequireScope(auth.ScopeCharactersRead)).Get("/collections", collectionHandler.List)
+		r.With(internal_middleware.RequireScope(auth.ScopeCharactersRead)).Get("/collections/{id}", collectionHandler.Get)
+		r.Group(func(r chi.Router) {
+			r.Use(internal_middleware.RequireScope(auth.ScopeCharactersWrite))
+			r.Post("/collections", collectionHandler.Create)
+			r.Put("/collections/{id}", collectionHandler.Update)
+			r.Delete("/collections/{id}", collectionHandler.Delete)
+			r.Post("/collections/{id}/items", collectionHandler.AddItem)
+			r.Put("/collections/{id}/items", collectionHandler.Reorder)
+			r.Delete("/collections/{id}/items/{characterID}", collectionHandler.RemoveItem)
+		})
+
+		r.With(internal_middleware.RequireScope(auth.ScopeCharactersRead)).Get("/users/{id}", userHandler.Get)
+		r.With(internal_middleware.RequireScope(auth.ScopeCharactersRead)).Get("/users/{id}/favorites", userHandler.ListFavorites)
+		r.Group(func(r chi.Router) {
+			r.Use(internal_middleware.RequireScope(auth.ScopeCharactersWrite))
+			r.Put("/users/{id}/favorites/{characterID}", userHandler.AddFavorite)
+			r.Delete("/users/{id}/favorites/{characterID}", userHandler.RemoveFavorite)
+		})
+		r.Get("/usage", usageHandler.Get)
+	})
+
+	r.Route("/admin/api-keys", func(r chi.Router) {
+		r.Use(ipFilter("admin"))
+		r.Use(internal_middleware.RequireAdminKey(cfg.AdminAPIKey))
+		r.Use(internal_middleware.Idempotency(redisClient, cfg.IdempotencyTTL))
+
+		r.Post("/", apiKeyHandler.Create)
+		r.Get("/", apiKeyHandler.List)
+		r.Post("/{id}/rotate", apiKeyHandler.Rotate)
+		r.Delete("/{id}", apiKeyHandler.Revoke)
+	})
+
+	r.Route("/admin/users", func(r chi.Router) {
+		r.Use(ipFilter("admin"))
+		r.Use(internal_middleware.RequireAdminKey(cfg.AdminAPIKey))
+		r.Use(internal_middleware.Idempotency(redisClient, cfg.IdempotencyTTL))
+
+		r.Post("/", userHandler.Create)
 	})
 
 	srv := &http.Server{
@@ -107,6 +323,25 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// The admin server stays off the public port, so operational endpoints
+	// never pass the ingress, the rate limits or the auth middleware.
+	adminSrv := &http.Server{
+		Addr: cfg.AdminAddr,
+		Handler: admin.NewRouter(admin.Options{
+			Metrics:  metricsHandler,
+			Config:   cfg.Redacted(),
+			Health:   http.HandlerFunc(healthHandler.Details),
+			AdminKey: cfg.AdminAPIKey,
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("admin server error")
+		}
+	}()
+	log.Info().Msgf("admin server listening on %s", cfg.AdminAddr)
+
 	log.Info().Msgf("server listening on port %s", cfg.Port)
 
 	// Start the server in a goroutine
@@ -115,6 +350,7 @@ func main() {
 			log.Fatal().Err(err).Msg("server error")
 		}
 	}()
+	healthHandler.MarkStarted()
 
 	// Listen for OS signals to perform a graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -123,6 +359,11 @@ func main() {
 
 	log.Info().Msg("Shutting down server...")
 
+	// Fail readiness first and give load balancers time to notice, so no
+	// new requests arrive once the listener closes.
+	healthHandler.Drain()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	// Create a context with a timeout for the shutdown
 	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -130,6 +371,9 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatal().Err(err).Msg("server shutdown failed")
 	}
+	if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("admin server shutdown failed")
+	}
 
 	log.Info().Msg("Server stopped.")
 }
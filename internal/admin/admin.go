@@ -0,0 +1,133 @@
+// Package admin serves operational endpoints on an address of their own,
+// which the Service and ingress never expose: pprof, metrics, build info,
+// the effective configuration, the detailed health report and runtime
+// controls. pprof and changes to
+// the runtime controls also require the admin key.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"aka-project/internal/logger"
+	"aka-project/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Version is stamped at build time with
+// -ldflags "-X aka-project/internal/admin.Version=...".
+var Version = "dev"
+
+var startedAt = time.Now()
+
+// Options configures NewRouter.
+type Options struct {
+	// Metrics serves /metrics; the route is absent when nil.
+	Metrics http.Handler
+	// Config is reported by /config. It must already be redacted.
+	Config any
+	// Health serves /health, the health report with each check's errors;
+	// the route is absent when nil.
+	Health http.Handler
+	// AdminKey must be sent as X-Admin-Key for pprof and PUT /loglevel.
+	// Those routes reject every request when it is empty.
+	AdminKey string
+}
+
+type BuildInfo struct {
+	Version   string    `json:"version"`
+	Revision  string    `json:"revision,omitempty"`
+	Modified  bool      `json:"modified,omitempty"`
+	GoVersion string    `json:"go_version"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+func NewRouter(opts Options) http.Handler {
+	r := chi.NewRouter()
+
+	requireKey := middleware.RequireAdminKey(opts.AdminKey)
+
+	r.Route("/debug/pprof", func(r chi.Router) {
+		r.Use(requireKey)
+		r.Get("/", pprof.Index)
+		r.Get("/cmdline", pprof.Cmdline)
+		r.Get("/profile", pprof.Profile)
+		r.Get("/symbol", pprof.Symbol)
+		r.Post("/symbol", pprof.Symbol)
+		r.Get("/trace", pprof.Trace)
+		// Named profiles: heap, goroutine, allocs, block, mutex...
+		r.Get("/{profile}", func(w http.ResponseWriter, r *http.Request) {
+			pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+		})
+	})
+	if opts.Metrics != nil {
+		r.Handle("/metrics", opts.Metrics)
+	}
+	if opts.Health != nil {
+		r.Handle("/health", opts.Health)
+	}
+	r.Get("/buildinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, buildInfo())
+	})
+	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, opts.Config)
+	})
+	r.Get("/loglevel", getLogLevel)
+	r.With(requireKey).Put("/loglevel", setLogLevel)
+	return r
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: Version, GoVersion: runtime.Version(), StartedAt: startedAt.UTC()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+func getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LogLevel{Level: logger.Level().String()})
+}
+
+// setLogLevel changes the default level until the next restart or change.
+func setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	level, err := zerolog.ParseLevel(req.Level)
+	if err != nil || req.Level == "" {
+		http.Error(w, "unknown log level", http.StatusBadRequest)
+		return
+	}
+	previous := logger.Level()
+	logger.SetLevel(level)
+	// Logged above the new level so the change itself is always recorded.
+	log.WithLevel(zerolog.NoLevel).Str("from", previous.String()).Str("to", level.String()).Msg("log level changed")
+	writeJSON(w, http.StatusOK, LogLevel{Level: level.String()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
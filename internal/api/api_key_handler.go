@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
+	"aka-project/internal/repository"
+	"aka-project/internal/tenant"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+type APIKeysRepo interface {
+	Create(ctx context.Context, k repository.NewAPIKey) (db.ApiKey, string, error)
+	List(ctx context.Context) ([]db.ApiKey, error)
+	Rotate(ctx context.Context, id int64, grace time.Duration) (db.ApiKey, string, error)
+	Revoke(ctx context.Context, id int64) (db.ApiKey, error)
+}
+
+type APIKeyHandler struct {
+	Repo APIKeysRepo
+	// RotationGrace is how long a rotated key keeps working when the
+	// request does not specify a grace period.
+	RotationGrace time.Duration
+	// Plans lists the configured rate-limit plans; DefaultPlan is used
+	// when a request names none.
+	Plans       []string
+	DefaultPlan string
+}
+
+// APIKeyResponse is the public view of a stored key. Key is only set when
+// the secret has just been issued.
+type APIKeyResponse struct {
+	ID         int64      `json:"id"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Owner      string     `json:"owner"`
+	Label      string     `json:"label"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ReplacedBy *int64     `json:"replaced_by,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	Plan       string     `json:"plan"`
+	UserID     *int64     `json:"user_id,omitempty"`
+	Tenant     string     `json:"tenant"`
+}
+
+type CreateAPIKeyRequest struct {
+	Owner string `json:"owner"`
+	Label string `json:"label"`
+	// Scopes defaults to read-only access when omitted.
+	Scopes []string `json:"scopes"`
+	// Plan selects the rate-limit plan; defaults to DefaultPlan.
+	Plan      string     `json:"plan"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// UserID links the key to a user so requests made with it act on
+	// that user's behalf. Owner defaults to "user:<id>" when set.
+	UserID *int64 `json:"user_id"`
+	// Tenant is the tenant whose data the key can reach; defaults to
+	// tenant.Default.
+	Tenant string `json:"tenant"`
+}
+
+type RotateAPIKeyRequest struct {
+	// GracePeriod is a Go duration string such as "24h".
+	GracePeriod string `json:"grace_period"`
+}
+
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+		return
+	}
+	if req.Owner == "" && req.UserID != nil {
+		req.Owner = "user:" + strconv.FormatInt(*req.UserID, 10)
+	}
+	if req.Owner == "" {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "owner is required"))
+		return
+	}
+	if req.Tenant == "" {
+		req.Tenant = tenant.Default
+	}
+	if !tenant.Valid(req.Tenant) {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid tenant"))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "expires_at must be in the future"))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{auth.ScopeCharactersRead}
+	}
+	if req.Plan == "" {
+		req.Plan = h.DefaultPlan
+	}
+	if len(h.Plans) > 0 && !slices.Contains(h.Plans, req.Plan) {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "unknown plan "+req.Plan))
+		return
+	}
+	for _, s := range req.Scopes {
+		if !auth.ValidScope(s) {
+			writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "unknown scope "+s))
+			return
+		}
+	}
+
+	key, raw, err := h.Repo.Create(ctx, repository.NewAPIKey{
+		Owner:     req.Owner,
+		Label:     req.Label,
+		Scopes:    req.Scopes,
+		Plan:      req.Plan,
+		ExpiresAt: req.ExpiresAt,
+		UserID:    req.UserID,
+		Tenant:    req.Tenant,
+	})
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to create api key")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("api_key_id", key.ID).Str("owner", key.Owner).Str("tenant", key.Tenant).Msg("api key created")
+
+	resp := toAPIKeyResponse(key)
+	resp.Key = raw
+	writeJSONStatus(w, http.StatusCreated, resp)
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	keys, err := h.Repo.List(ctx)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to list api keys")
+		writeError(w, err)
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, toAPIKeyResponse(k))
+	}
+	writeJSON(w, resp)
+}
+
+func (h *APIKeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	grace := h.RotationGrace
+	var req RotateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+			return
+		}
+	}
+	if req.GracePeriod != "" {
+		grace, err = time.ParseDuration(req.GracePeriod)
+		if err != nil || grace < 0 {
+			writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid grace_period"))
+			return
+		}
+	}
+
+	key, raw, err := h.Repo.Rotate(ctx, id, grace)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to rotate api key")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("api_key_id", id).Int64("replaced_by", key.ID).Dur("grace", grace).Msg("api key rotated")
+
+	resp := toAPIKeyResponse(key)
+	resp.Key = raw
+	writeJSONStatus(w, http.StatusCreated, resp)
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	key, err := h.Repo.Revoke(ctx, id)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to revoke api key")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("api_key_id", id).Msg("api key revoked")
+
+	writeJSON(w, toAPIKeyResponse(key))
+}
+
+func toAPIKeyResponse(k db.ApiKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:        k.ID,
+		Prefix:    k.Prefix,
+		Owner:     k.Owner,
+		Label:     k.Label,
+		CreatedAt: k.CreatedAt,
+		Scopes:    k.Scopes,
+		Plan:      k.Plan,
+		Tenant:    k.Tenant,
+	}
+	if k.ExpiresAt.Valid {
+		resp.ExpiresAt = &k.ExpiresAt.Time
+	}
+	if k.RevokedAt.Valid {
+		resp.RevokedAt = &k.RevokedAt.Time
+	}
+	if k.LastUsedAt.Valid {
+		resp.LastUsedAt = &k.LastUsedAt.Time
+	}
+	if k.ReplacedBy.Valid {
+		resp.ReplacedBy = &k.ReplacedBy.Int64
+	}
+	if k.UserID.Valid {
+		resp.UserID = &k.UserID.Int64
+	}
+	return resp
+}
+
+func pathID(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil {
+		return 0, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid "+name)
+	}
+	return id, nil
+}
@@ -3,12 +3,14 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"aka-project/internal"
 	"aka-project/internal/db"
 	"aka-project/internal/repository"
+	"aka-project/internal/telemetry"
 
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel/attribute"
@@ -16,7 +18,7 @@ import (
 )
 
 type CharactersRepo interface {
-	GetCharacters(ctx context.Context, species string, status string, origin string) (repository.CharactersResponse, error)
+	GetCharacters(ctx context.Context, species string, status string, origin string, tag string) (repository.CharactersResponse, error)
 }
 
 type CharacterHandler struct {
@@ -24,7 +26,7 @@ type CharacterHandler struct {
 	Meter                      metric.Meter
 	requestCounter             metric.Int64Counter
 	errorCounter               metric.Int64Counter
-	durationHistogram          metric.Int64Histogram
+	durationHistogram          metric.Float64Histogram
 	charactersProcessedCounter metric.Int64Counter
 }
 
@@ -45,10 +47,11 @@ func NewCharacterHandler(repo CharactersRepo, meter metric.Meter) (*CharacterHan
 		return nil, err
 	}
 
-	durationHistogram, err := meter.Int64Histogram(
+	durationHistogram, err := meter.Float64Histogram(
 		"api.characters.request_duration_seconds",
 		metric.WithDescription("Duration of requests to the /characters endpoint in seconds"),
 		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(telemetry.DurationBuckets...),
 	)
 	if err != nil {
 		return nil, err
@@ -93,32 +96,41 @@ func (h *CharacterHandler) GetCharacters(w http.ResponseWriter, r *http.Request)
 		ctx,
 		r.URL.Query().Get("species"),
 		r.URL.Query().Get("status"),
-		r.URL.Query().Get("origin"))
+		r.URL.Query().Get("origin"),
+		r.URL.Query().Get("tag"))
 
 	if err != nil {
-		h.errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("error.type", err.Error())))
-		log.Error().Err(err).Msg("failed to get characters")
-		//nolint:errorlint
-		switch e := err.(*internal.Error); e.Code {
-		case internal.ErrorCodeNotFound:
-			http.Error(w, e.Message, http.StatusNotFound)
-		case internal.ErrorCodeUnauthorized:
-			http.Error(w, e.Message, http.StatusUnauthorized)
-		default:
-			http.Error(w, "internal error", http.StatusInternalServerError)
-		}
+		h.errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("error.type", internal.Code(err))))
+		internal.LogError(log, err).Msg("failed to get characters")
+		writeError(w, err)
 		return
 	}
 
 	h.charactersProcessedCounter.Add(ctx, int64(len(characterResponse.Results)))
 
-	duration := time.Since(start).Milliseconds()
-	h.durationHistogram.Record(ctx, duration)
+	h.durationHistogram.Record(ctx, time.Since(start).Seconds())
 
 	writeJSON(w, characterResponse)
 }
 
+// writeError responds with the status hinted by err. Messages are only exposed
+// for client errors; anything else is reported as a generic internal error.
+func writeError(w http.ResponseWriter, err error) {
+	status := internal.HTTPStatus(err)
+	var e *internal.Error
+	if status >= http.StatusInternalServerError || !errors.As(err, &e) {
+		http.Error(w, "internal error", status)
+		return
+	}
+	http.Error(w, e.Message, status)
+}
+
 func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
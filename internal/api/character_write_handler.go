@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxCharacterTags = 20
+	maxTagLength     = 50
+)
+
+type CharacterWriteRepo interface {
+	CreateCustom(ctx context.Context, c repository.NewCharacter, by string) (repository.Character, error)
+	Patch(ctx context.Context, id int32, p repository.CharacterPatch, by string) (repository.Character, error)
+	Delete(ctx context.Context, id int32) error
+}
+
+// CharacterWriteHandler serves local edits: custom characters and
+// overrides of upstream ones.
+type CharacterWriteHandler struct {
+	Repo CharacterWriteRepo
+}
+
+type CreateCharacterRequest struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Species  string   `json:"species"`
+	Type     string   `json:"type"`
+	Gender   string   `json:"gender"`
+	Image    string   `json:"image"`
+	Nickname string   `json:"nickname"`
+	Tags     []string `json:"tags"`
+}
+
+// PatchCharacterRequest changes a character's local override. Omitted
+// fields are unchanged; an empty string drops a correction.
+type PatchCharacterRequest struct {
+	Nickname *string   `json:"nickname"`
+	Name     *string   `json:"name"`
+	Status   *string   `json:"status"`
+	Species  *string   `json:"species"`
+	Type     *string   `json:"type"`
+	Gender   *string   `json:"gender"`
+	Image    *string   `json:"image"`
+	Tags     *[]string `json:"tags"`
+	Hidden   *bool     `json:"hidden"`
+}
+
+func (h *CharacterWriteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req CreateCharacterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "name is required"))
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	c, err := h.Repo.CreateCustom(ctx, repository.NewCharacter{
+		Name:     req.Name,
+		Status:   req.Status,
+		Species:  req.Species,
+		Type:     req.Type,
+		Gender:   req.Gender,
+		Image:    req.Image,
+		Nickname: req.Nickname,
+		Tags:     tags,
+	}, editor(ctx))
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to create character")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int32("character_id", c.ID).Msg("custom character created")
+
+	writeJSONStatus(w, http.StatusCreated, c)
+}
+
+func (h *CharacterWriteHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := characterID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var req PatchCharacterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+		return
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		req.Tags = &tags
+	}
+
+	c, err := h.Repo.Patch(ctx, id, repository.CharacterPatch{
+		Nickname: req.Nickname,
+		Name:     req.Name,
+		Status:   req.Status,
+		Species:  req.Species,
+		Type:     req.Type,
+		Gender:   req.Gender,
+		Image:    req.Image,
+		Tags:     req.Tags,
+		Hidden:   req.Hidden,
+	}, editor(ctx))
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to update character")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int32("character_id", id).Msg("character override updated")
+
+	writeJSON(w, c)
+}
+
+func (h *CharacterWriteHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := characterID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.Repo.Delete(ctx, id); err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to delete character")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int32("character_id", id).Msg("character deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func characterID(r *http.Request, name string) (int32, error) {
+	id, err := pathID(r, name)
+	if err != nil || id <= 0 || id > 1<<31-1 {
+		return 0, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid id")
+	}
+	return int32(id), nil
+}
+
+// normalizeTags lower-cases, trims and de-duplicates tags.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxCharacterTags {
+		return nil, internal.NewError(internal.ErrorCodeInvalidArgument, "too many tags")
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || len(t) > maxTagLength {
+			return nil, internal.NewError(internal.ErrorCodeInvalidArgument, "tags must be 1 to 50 characters")
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// editor names the caller for ownership and audit columns. Keys linked to
+// a user act as that user, so all of a user's keys share their data; other
+// keys' collections follow them when they are rotated.
+func editor(ctx context.Context) string {
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if id.UserID != 0 {
+		return "user:" + strconv.FormatInt(id.UserID, 10)
+	}
+	return id.Key()
+}
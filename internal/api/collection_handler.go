@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/internal/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+const maxCollectionNameLength = 100
+
+type CollectionsRepo interface {
+	Create(ctx context.Context, owner string, in repository.CollectionInput) (repository.Collection, error)
+	List(ctx context.Context, owner, tag string) ([]db.Collection, error)
+	Get(ctx context.Context, owner string, id int64) (repository.Collection, error)
+	Update(ctx context.Context, owner string, id int64, in repository.CollectionInput) (repository.Collection, error)
+	Delete(ctx context.Context, owner string, id int64) error
+	AddItem(ctx context.Context, owner string, id int64, characterID int32) (repository.CollectionItem, error)
+	RemoveItem(ctx context.Context, owner string, id int64, characterID int32) error
+	Reorder(ctx context.Context, owner string, id int64, characterIDs []int32) ([]repository.CollectionItem, error)
+}
+
+// CollectionHandler serves the caller's own character collections.
+type CollectionHandler struct {
+	Repo CollectionsRepo
+}
+
+type CollectionRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type AddCollectionItemRequest struct {
+	CharacterID int32 `json:"character_id"`
+}
+
+type ReorderCollectionRequest struct {
+	CharacterIDs []int32 `json:"character_ids"`
+}
+
+func (h *CollectionHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	collections, err := h.Repo.List(ctx, editor(ctx), strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag"))))
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to list collections")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, collections)
+}
+
+func (h *CollectionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	in, err := decodeCollection(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	c, err := h.Repo.Create(ctx, editor(ctx), in)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to create collection")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("collection_id", c.ID).Msg("collection created")
+
+	writeJSONStatus(w, http.StatusCreated, c)
+}
+
+func (h *CollectionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	c, err := h.Repo.Get(ctx, editor(ctx), id)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to get collection")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (h *CollectionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	in, err := decodeCollection(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	c, err := h.Repo.Update(ctx, editor(ctx), id, in)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to update collection")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (h *CollectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.Repo.Delete(ctx, editor(ctx), id); err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to delete collection")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("collection_id", id).Msg("collection deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CollectionHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var req AddCollectionItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+		return
+	}
+	if req.CharacterID <= 0 {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "character_id is required"))
+		return
+	}
+	item, err := h.Repo.AddItem(ctx, editor(ctx), id, req.CharacterID)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to add collection item")
+		writeError(w, err)
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, item)
+}
+
+func (h *CollectionHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	charID, err := characterID(r, "characterID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.Repo.RemoveItem(ctx, editor(ctx), id, charID); err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to remove collection item")
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reorder sets the order of the collection's items to the given list.
+func (h *CollectionHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var req ReorderCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+		return
+	}
+	items, err := h.Repo.Reorder(ctx, editor(ctx), id, req.CharacterIDs)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to reorder collection")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, items)
+}
+
+func decodeCollection(r *http.Request) (repository.CollectionInput, error) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return repository.CollectionInput{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body"))
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxCollectionNameLength {
+		return repository.CollectionInput{}, internal.NewError(internal.ErrorCodeInvalidArgument, "name must be 1 to 100 characters")
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return repository.CollectionInput{}, err
+	}
+	return repository.CollectionInput{Name: req.Name, Description: req.Description, Tags: tags}, nil
+}
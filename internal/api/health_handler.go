@@ -1,50 +1,109 @@
 package api
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
-	"time"
+	"sync/atomic"
 
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/redis/go-redis/v9"
+	"aka-project/internal/health"
 )
 
+// HealthHandler serves the Kubernetes probes:
+//
+//   - /livez only reports that the process can serve HTTP, so a slow
+//     dependency never gets the pod restarted;
+//   - /readyz runs the registered checks and answers 503 while a critical
+//     one fails, or once the server has started draining. Failing
+//     non-critical checks report "degraded" but keep the pod in rotation;
+//   - /startupz answers 503 until MarkStarted is called.
+//
+// The probes are public, so they only name each check and its status.
+// Details serves the full report, errors included, for the admin server.
 type HealthHandler struct {
-	DB    *pgxpool.Pool
-	Redis *redis.Client
+	Checks *health.Registry
+
+	started  atomic.Bool
+	draining atomic.Bool
 }
 
 type HealthStatus struct {
-	Status string            `json:"status"`
-	Checks map[string]string `json:"checks"`
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks,omitempty"`
+}
+
+// CheckStatus is what the public probes reveal about a check. Errors may
+// name hosts, ports and users, so they are left to Details.
+type CheckStatus struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+}
+
+// HealthReport is the detailed report served by Details.
+type HealthReport struct {
+	Status string                   `json:"status"`
+	Checks map[string]health.Result `json:"checks,omitempty"`
+}
+
+// MarkStarted lets /startupz and /readyz succeed once initialisation is done.
+func (h *HealthHandler) MarkStarted() {
+	h.started.Store(true)
+}
+
+// Drain makes /readyz fail from now on so load balancers stop sending new
+// requests before the server shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
 }
 
-func (h *HealthHandler) Check(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, health.StatusOK, HealthStatus{Status: health.StatusOK})
+}
 
-	dbStatus := "ok"
-	if err := h.DB.Ping(ctx); err != nil {
-		dbStatus = "error"
+func (h *HealthHandler) Startup(w http.ResponseWriter, r *http.Request) {
+	if !h.started.Load() {
+		writeHealth(w, "starting", HealthStatus{Status: "starting"})
+		return
 	}
+	writeHealth(w, health.StatusOK, HealthStatus{Status: health.StatusOK})
+}
 
-	redisStatus := "ok"
-	if _, err := h.Redis.Ping(ctx).Result(); err != nil {
-		redisStatus = "error"
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.report(r)
+	status := HealthStatus{Status: report.Status}
+	if report.Checks != nil {
+		status.Checks = make(map[string]CheckStatus, len(report.Checks))
+		for name, res := range report.Checks {
+			status.Checks[name] = CheckStatus{Status: res.Status, Critical: res.Critical}
+		}
 	}
+	writeHealth(w, status.Status, status)
+}
 
-	status := "ok"
-	if dbStatus == "error" || redisStatus == "error" {
-		status = "error"
+// Details answers like Ready with the full result of every check, including
+// its errors.
+func (h *HealthHandler) Details(w http.ResponseWriter, r *http.Request) {
+	report := h.report(r)
+	writeHealth(w, report.Status, report)
+}
+
+func (h *HealthHandler) report(r *http.Request) HealthReport {
+	switch {
+	case h.draining.Load():
+		return HealthReport{Status: "draining"}
+	case !h.started.Load():
+		return HealthReport{Status: "starting"}
 	}
+	report := h.Checks.Run(r.Context())
+	return HealthReport{Status: report.Status, Checks: report.Checks}
+}
 
+// writeHealth answers 200 for "ok" and "degraded" and 503 otherwise, so
+// probes need not parse the body.
+func writeHealth(w http.ResponseWriter, status string, body any) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(HealthStatus{
-		Status: status,
-		Checks: map[string]string{
-			"database": dbStatus,
-			"redis":    redisStatus,
-		},
-	})
+	w.Header().Set("Cache-Control", "no-store")
+	if status != health.StatusOK && status != health.StatusDegraded {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
 }
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxUsageRange bounds how many days a single usage report may cover.
+const maxUsageRange = 366 * 24 * time.Hour
+
+type UsageRepo interface {
+	Usage(ctx context.Context, subject string, from, to time.Time) ([]repository.DayUsage, error)
+	Current(ctx context.Context, subject string, now time.Time) (repository.QuotaUsage, error)
+}
+
+type UsageHandler struct {
+	Repo UsageRepo
+	// Quotas and DefaultPlan mirror the quota middleware configuration so
+	// the report can show the caller's limits.
+	Quotas      map[string]repository.Quota
+	DefaultPlan string
+}
+
+type UsageResponse struct {
+	Subject string                `json:"subject"`
+	Plan    string                `json:"plan"`
+	From    string                `json:"from"`
+	To      string                `json:"to"`
+	Quota   *QuotaResponse        `json:"quota,omitempty"`
+	Total   int64                 `json:"total"`
+	Days    []repository.DayUsage `json:"days"`
+}
+
+// QuotaResponse shows the caller's limits and consumption in the current
+// periods. A zero limit means the period is not capped.
+type QuotaResponse struct {
+	DailyLimit   int64 `json:"daily_limit"`
+	DailyUsed    int64 `json:"daily_used"`
+	MonthlyLimit int64 `json:"monthly_limit"`
+	MonthlyUsed  int64 `json:"monthly_used"`
+}
+
+// Get reports the caller's consumption per day and endpoint. The optional
+// from and to query parameters are inclusive YYYY-MM-DD dates and default to
+// the last 30 days.
+func (h *UsageHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		writeError(w, internal.NewError(internal.ErrorCodeUnauthorized, "unauthorized"))
+		return
+	}
+
+	now := time.Now().UTC()
+	to, err := queryDate(r, "to", now)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	from, err := queryDate(r, "from", to.AddDate(0, 0, -29))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if from.After(to) {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "from must not be after to"))
+		return
+	}
+	if to.Sub(from) >= maxUsageRange {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "date range is too long"))
+		return
+	}
+
+	subject := id.Key()
+	days, err := h.Repo.Usage(ctx, subject, from, to)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to get usage")
+		writeError(w, err)
+		return
+	}
+
+	plan := id.Plan
+	if plan == "" {
+		plan = h.DefaultPlan
+	}
+	resp := UsageResponse{
+		Subject: subject,
+		Plan:    plan,
+		From:    from.Format(time.DateOnly),
+		To:      to.Format(time.DateOnly),
+		Days:    days,
+	}
+	for _, d := range days {
+		resp.Total += d.Total
+	}
+	if quota, ok := h.Quotas[plan]; ok {
+		used, err := h.Repo.Current(ctx, subject, now)
+		if err != nil {
+			internal.LogError(log.Ctx(ctx), err).Msg("failed to get current quota usage")
+		}
+		resp.Quota = &QuotaResponse{
+			DailyLimit:   quota.Daily,
+			DailyUsed:    used.Day,
+			MonthlyLimit: quota.Monthly,
+			MonthlyUsed:  used.Month,
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func queryDate(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def.Truncate(24 * time.Hour), nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid "+name+" date")
+	}
+	return t, nil
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/models"
+	"aka-project/internal/repository"
+	"aka-project/internal/tenant"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// userIDMe addresses the user linked to the calling API key.
+const userIDMe = "me"
+
+type UsersRepo interface {
+	Create(ctx context.Context, name, email string) (models.User, error)
+	Get(ctx context.Context, id int64) (models.User, error)
+	Favorites(ctx context.Context, userID int64) ([]repository.Character, error)
+	AddFavorite(ctx context.Context, userID int64, characterID int32) (repository.Character, error)
+	RemoveFavorite(ctx context.Context, userID int64, characterID int32) error
+}
+
+// UserHandler serves user accounts and their favorite characters. Callers
+// may only act on the user their API key is linked to, unless they hold
+// the admin scope.
+type UserHandler struct {
+	Repo UsersRepo
+}
+
+type CreateUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// Tenant is the tenant the user belongs to; defaults to
+	// tenant.Default.
+	Tenant string `json:"tenant"`
+}
+
+// Create registers a user. It is served on the admin routes, which are not
+// tied to a tenant, so the tenant comes from the request body.
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid request body")))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "name is required"))
+		return
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Name != "" {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "email is invalid"))
+		return
+	}
+	if req.Tenant == "" {
+		req.Tenant = tenant.Default
+	}
+	if !tenant.Valid(req.Tenant) {
+		writeError(w, internal.NewError(internal.ErrorCodeInvalidArgument, "invalid tenant"))
+		return
+	}
+	ctx = tenant.WithTenant(ctx, req.Tenant)
+
+	user, err := h.Repo.Create(ctx, req.Name, strings.ToLower(addr.Address))
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to create user")
+		writeError(w, err)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("user_id", user.ID).Str("tenant", user.Tenant).Msg("user created")
+
+	writeJSONStatus(w, http.StatusCreated, user)
+}
+
+func (h *UserHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	user, err := h.Repo.Get(ctx, id)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to get user")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, user)
+}
+
+func (h *UserHandler) ListFavorites(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	favorites, err := h.Repo.Favorites(ctx, id)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to list favorites")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, favorites)
+}
+
+func (h *UserHandler) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	charID, err := characterID(r, "characterID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	c, err := h.Repo.AddFavorite(ctx, id, charID)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to add favorite")
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (h *UserHandler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	charID, err := characterID(r, "characterID")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.Repo.RemoveFavorite(ctx, id, charID); err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to remove favorite")
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userID resolves the {id} path parameter, which may be "me", and checks
+// that the caller may act on that user.
+func userID(r *http.Request) (int64, error) {
+	caller, _ := auth.IdentityFromContext(r.Context())
+	if chi.URLParam(r, "id") == userIDMe {
+		if caller == nil || caller.UserID == 0 {
+			return 0, internal.NewError(internal.ErrorCodeForbidden, "this credential is not linked to a user")
+		}
+		return caller.UserID, nil
+	}
+
+	id, err := pathID(r, "id")
+	if err != nil {
+		return 0, err
+	}
+	if caller == nil || (caller.UserID != id && !caller.HasScope(auth.ScopeAdmin)) {
+		return 0, internal.NewError(internal.ErrorCodeForbidden, "this credential cannot act on behalf of this user").
+			WithFields(map[string]any{"entity": "user", "id": id})
+	}
+	return id, nil
+}
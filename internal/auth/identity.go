@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Authentication methods recorded on an Identity.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// ErrNoCredentials is returned by authenticators when a request carries no
+// credentials of their kind, so the next one in a chain can be tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity describes the authenticated caller of a request.
+type Identity struct {
+	Method string
+	// KeyID is set for API key callers.
+	KeyID  int64
+	Prefix string
+	// Subject identifies callers that are not API keys, e.g. a token's sub.
+	Subject string
+	Owner   string
+	Label   string
+	Scopes  []string
+	// Plan selects the rate-limit plan; empty means the default plan.
+	Plan string
+	// UserID is the user an API key acts for; 0 when it is not linked.
+	UserID int64
+	// Tenant is the tenant whose data the caller can reach.
+	Tenant string
+}
+
+// Key returns a stable identifier for the caller, used for rate limiting
+// and logging.
+func (id *Identity) Key() string {
+	if id.Method == MethodAPIKey {
+		return APIKeySubject(id.KeyID)
+	}
+	return id.Method + ":" + id.Subject
+}
+
+// APIKeySubject is the Key of callers using API key id.
+func APIKeySubject(id int64) string {
+	return fmt.Sprintf("key:%d", id)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity stored in ctx, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
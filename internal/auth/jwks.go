@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minJWKSRefresh throttles refreshes triggered by tokens with unknown key
+// IDs, so forged kids cannot turn into a request flood against the source.
+// It is also how long a failed refresh is backed off before the next try.
+const minJWKSRefresh = time.Minute
+
+// JWKS holds token verification keys loaded from a local file or a URL.
+// Keys are cached and reloaded once they are older than the refresh interval
+// or when a token names a key ID that is not known yet.
+type JWKS struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+
+	// refreshMu is held across a fetch so concurrent callers share it; it
+	// guards attempted and lastErr.
+	refreshMu sync.Mutex
+	attempted time.Time
+	lastErr   error
+}
+
+// NewJWKS loads the key set from source, which is either an http(s) URL or
+// a file path, and fails if the initial load does.
+func NewJWKS(ctx context.Context, source string, refresh time.Duration) (*JWKS, error) {
+	j := &JWKS{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := j.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Key returns the public key with the given key ID.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	now := time.Now()
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	age := now.Sub(j.fetched)
+	j.mu.RUnlock()
+
+	stale := age > j.refresh
+	if !ok && age > minJWKSRefresh {
+		stale = true
+	}
+	if stale {
+		if err := j.refreshSince(ctx, now); err != nil {
+			// Keep serving the last good set rather than failing closed.
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		j.mu.RLock()
+		key, ok = j.keys[kid]
+		j.mu.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// Refresh reloads the key set from its source.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	return j.load(ctx)
+}
+
+// refreshSince reloads the key set unless another caller attempted it after
+// seen, in which case that attempt's outcome is shared, or the last attempt
+// failed less than minJWKSRefresh ago.
+func (j *JWKS) refreshSince(ctx context.Context, seen time.Time) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	if j.attempted.After(seen) {
+		return j.lastErr
+	}
+	if j.lastErr != nil && time.Since(j.attempted) < minJWKSRefresh {
+		return j.lastErr
+	}
+	// Waiters share the fetch, so it must not fail when the request that
+	// started it goes away; the client timeout still bounds it.
+	return j.load(context.WithoutCancel(ctx))
+}
+
+// load fetches and installs the key set. refreshMu must be held.
+func (j *JWKS) load(ctx context.Context) error {
+	j.attempted = time.Now()
+	j.lastErr = j.fetch(ctx)
+	return j.lastErr
+}
+
+func (j *JWKS) fetch(ctx context.Context) error {
+	raw, err := j.read(ctx)
+	if err != nil {
+		return fmt.Errorf("load jwks: %w", err)
+	}
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		return fmt.Errorf("parse jwks: %w", err)
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetched = time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64BigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64BigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64BigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64BigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func b64BigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig controls which tokens a JWTVerifier accepts.
+type JWTConfig struct {
+	Issuer   string
+	Audience string
+	// ScopeClaim names the claim holding granted scopes, either as a
+	// space-separated string or a list. Defaults to "scope".
+	ScopeClaim string
+	// ScopeMap translates identity-provider scopes or roles into API
+	// scopes. Claim values that are already API scopes pass through.
+	ScopeMap map[string][]string
+	// TenantClaim names the claim holding the caller's tenant. Tokens
+	// without it act for tenant.Default. Defaults to "tenant".
+	TenantClaim string
+	// Plan is the rate-limit plan assigned to token callers.
+	Plan   string
+	Leeway time.Duration
+}
+
+// JWTVerifier validates bearer tokens against a JWKS.
+type JWTVerifier struct {
+	keys   *JWKS
+	cfg    JWTConfig
+	parser *jwt.Parser
+}
+
+func NewJWTVerifier(keys *JWKS, cfg JWTConfig) *JWTVerifier {
+	if cfg.ScopeClaim == "" {
+		cfg.ScopeClaim = "scope"
+	}
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = "tenant"
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &JWTVerifier{keys: keys, cfg: cfg, parser: jwt.NewParser(opts...)}
+}
+
+// Verify checks the token signature, issuer, audience and expiry and returns
+// the identity it describes.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeUnauthorized, "invalid bearer token"))
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "bearer token has no subject")
+	}
+	tenantID, _ := claims[v.cfg.TenantClaim].(string)
+	if tenantID == "" {
+		tenantID = tenant.Default
+	}
+	if !tenant.Valid(tenantID) {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "bearer token has an invalid tenant")
+	}
+	label, _ := claims["azp"].(string)
+	if label == "" {
+		label, _ = claims["client_id"].(string)
+	}
+
+	return &Identity{
+		Method:  MethodJWT,
+		Subject: sub,
+		Owner:   sub,
+		Label:   label,
+		Scopes:  v.scopes(claims),
+		Plan:    v.cfg.Plan,
+		Tenant:  tenantID,
+	}, nil
+}
+
+func (v *JWTVerifier) scopes(claims jwt.MapClaims) []string {
+	var granted []string
+	switch raw := claims[v.cfg.ScopeClaim].(type) {
+	case string:
+		granted = strings.Fields(raw)
+	case []any:
+		for _, s := range raw {
+			if str, ok := s.(string); ok {
+				granted = append(granted, str)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	var scopes []string
+	add := func(s string) {
+		if ValidScope(s) && !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	for _, g := range granted {
+		add(g)
+		for _, mapped := range v.cfg.ScopeMap[g] {
+			add(mapped)
+		}
+	}
+	return scopes
+}
+
+// ParseScopeMap parses "idp-scope=api:scope|api:scope2,role=admin" into a
+// scope map.
+func ParseScopeMap(spec []string) (map[string][]string, error) {
+	m := map[string][]string{}
+	for _, entry := range spec {
+		from, to, ok := strings.Cut(entry, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid scope mapping %q", entry)
+		}
+		for _, s := range strings.Split(to, "|") {
+			if !ValidScope(s) {
+				return nil, fmt.Errorf("unknown scope %q in mapping %q", s, entry)
+			}
+			m[from] = append(m[from], s)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import "slices"
+
+// Scopes grantable to API keys.
+const (
+	ScopeCharactersRead  = "characters:read"
+	ScopeCharactersWrite = "characters:write"
+	// ScopeAdmin satisfies every other scope.
+	ScopeAdmin = "admin"
+)
+
+// KnownScopes lists every scope the API understands.
+var KnownScopes = []string{
+	ScopeCharactersRead,
+	ScopeCharactersWrite,
+	ScopeAdmin,
+}
+
+// ValidScope reports whether s is a known scope.
+func ValidScope(s string) bool {
+	return slices.Contains(KnownScopes, s)
+}
+
+// HasScope reports whether the identity was granted scope, directly or
+// through the admin scope.
+func (id *Identity) HasScope(scope string) bool {
+	return slices.Contains(id.Scopes, scope) || slices.Contains(id.Scopes, ScopeAdmin)
+}
+
+// MissingScopes returns the entries of required the identity lacks.
+func (id *Identity) MissingScopes(required ...string) []string {
+	var missing []string
+	for _, s := range required {
+		if !id.HasScope(s) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
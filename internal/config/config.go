@@ -1,29 +1,201 @@
 package config
 
 import (
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Config holds the settings read from the environment. Fields holding
+// credentials are tagged redact:"secret" so Redacted masks them; URLs are
+// masked wherever they appear.
 type Config struct {
-	DBUrl         string
-	RedisAddr     string
-	Port          string
+	DBUrl string
+	// DBSlowQueryThreshold is the duration above which queries are logged
+	// as slow; 0 disables the log.
+	DBSlowQueryThreshold time.Duration
+	RedisAddr            string
+	Port                 string
+	// LogLevel is the default minimum level, e.g. "info" or "debug". It can
+	// be changed at runtime through the admin server.
+	LogLevel      string
 	RateLimitSpec string
+	// RateLimitPlans maps plan names to formatted rates or "unlimited".
+	RateLimitPlans       map[string]string
+	RateLimitDefaultPlan string
+	// RateLimitRouteCosts maps chi route patterns to the number of
+	// requests a call consumes.
+	RateLimitRouteCosts map[string]string
+	// RateLimitQuotas maps plan names to "daily/monthly" call quotas; 0
+	// leaves a period uncapped and plans without an entry are unmetered.
+	RateLimitQuotas map[string]string
+	// RateLimitFailureMode is "open" (fall back to per-replica in-memory
+	// limits) or "closed" (reject with 503) while Redis is unreachable.
+	RateLimitFailureMode string
+	UsageRollupInterval  time.Duration
+	// HealthCheckTimeout bounds each dependency check behind /readyz. Keep
+	// it below the readiness probe's timeout.
+	HealthCheckTimeout time.Duration
+	// HealthCheckCacheTTL is how long a readiness report is reused before
+	// the checks run again.
+	HealthCheckCacheTTL time.Duration
+	// HealthSyncMaxAge is how old the last upstream sync may get before
+	// readiness reports "degraded".
+	HealthSyncMaxAge time.Duration
+	// ShutdownDrainDelay is how long /readyz fails before the server stops
+	// accepting connections, so load balancers can take the pod out first.
+	ShutdownDrainDelay time.Duration
+	// OTELCollector is the OTLP gRPC endpoint traces and metrics are
+	// exported to; spans are not exported when it is empty, and the otlp and
+	// both metrics exporters require it.
 	OTELCollector string
-	APIKey        string
-	RMAPI         string
+	// MetricsExporter is "otlp" (push to the collector), "prometheus"
+	// (serve /metrics on AdminAddr), "both" or "none".
+	MetricsExporter string
+	// AdminAddr serves pprof, /metrics, build info, the redacted config and
+	// runtime controls, away from the public port. It defaults to loopback;
+	// bind it to the pod IP for Prometheus to scrape.
+	AdminAddr string
+	// TraceSampleRatio is the fraction of new traces sampled. Requests whose
+	// caller sampled the trace are always traced.
+	TraceSampleRatio float64
+	// TrustedProxies lists CIDRs or addresses of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed.
+	TrustedProxies []string
+	// IPRulesSource is "postgres" to read allow/deny rules from the
+	// ip_rules table, or a path to a JSON rules file. Filtering is
+	// disabled when empty.
+	IPRulesSource string
+	// IdempotencyTTL is how long responses to requests carrying an
+	// Idempotency-Key are kept for replay.
+	IdempotencyTTL time.Duration
+	// APIKey, when set, is seeded into the api_keys table at startup so
+	// existing deployments keep working while keys move to Postgres.
+	APIKey         string `redact:"secret"`
+	APIKeyScopes   []string
+	APIKeyPlan     string
+	APIKeyCacheTTL time.Duration
+	// AdminAPIKey guards the /admin routes; they are disabled when empty.
+	AdminAPIKey string `redact:"secret"`
+	// DebugLogSecret verifies X-Debug-Log headers, which enable debug
+	// logging for a single admin request; the header is ignored when empty.
+	DebugLogSecret      string `redact:"secret"`
+	APIKeyRotationGrace time.Duration
+	RMAPI               string
+
+	// JWTJWKS is a JWKS URL or file path; bearer tokens are only accepted
+	// when it is set.
+	JWTJWKS        string
+	JWTJWKSRefresh time.Duration
+	JWTIssuer      string
+	JWTAudience    string
+	JWTScopeClaim  string
+	JWTTenantClaim string
+	// JWTScopeMap entries look like "idp-scope=characters:read|admin".
+	JWTScopeMap []string
+	JWTPlan     string
+
+	// HMACClientsFile lists server-to-server clients allowed to sign
+	// requests; HMAC auth is disabled when empty.
+	HMACClientsFile string
+	HMACMaxSkew     time.Duration
 }
 
 func Load() *Config {
 	return &Config{
-		DBUrl:         getenv("DATABASE_URL", "postgres://postgres:password@db:5432/myapp?sslmode=disable"),
-		RedisAddr:     getenv("REDIS_ADDR", "redis:6379"),
-		Port:          getenv("PORT", "8080"),
-		RateLimitSpec: getenv("RATE_LIMIT_SPEC", "100-M"),
-		OTELCollector: getenv("OTEL_COLLECTOR_URL", "http://otel-collector:4317"),
-		APIKey:        getenv("API_KEY", "my-secret-key"),
-		RMAPI:         getenv("RM_API_ENDPOINT", "https://rickandmortyapi.com/api/character"),
+		DBUrl:                getenv("DATABASE_URL", "postgres://postgres:password@db:5432/myapp?sslmode=disable"),
+		DBSlowQueryThreshold: getenvDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+		RedisAddr:            getenv("REDIS_ADDR", "redis:6379"),
+		Port:                 getenv("PORT", "8080"),
+		LogLevel:             getenv("LOG_LEVEL", "info"),
+		RateLimitSpec:        getenv("RATE_LIMIT_SPEC", "100-M"),
+		RateLimitPlans:       getenvMap("RATE_LIMIT_PLANS", map[string]string{"free": "60-M", "partner": "1000-M", "internal": "unlimited"}),
+		RateLimitDefaultPlan: getenv("RATE_LIMIT_DEFAULT_PLAN", "free"),
+		RateLimitRouteCosts:  getenvMap("RATE_LIMIT_ROUTE_COSTS", nil),
+		RateLimitQuotas:      getenvMap("RATE_LIMIT_QUOTAS", map[string]string{"free": "1000/20000", "partner": "100000/2000000"}),
+		RateLimitFailureMode: getenv("RATE_LIMIT_FAILURE_MODE", "open"),
+		UsageRollupInterval:  getenvDuration("USAGE_ROLLUP_INTERVAL", 5*time.Minute),
+		HealthCheckTimeout:   getenvDuration("HEALTH_CHECK_TIMEOUT", time.Second),
+		HealthCheckCacheTTL:  getenvDuration("HEALTH_CHECK_CACHE_TTL", 2*time.Second),
+		HealthSyncMaxAge:     getenvDuration("HEALTH_SYNC_MAX_AGE", time.Hour),
+		ShutdownDrainDelay:   getenvDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		TrustedProxies:       getenvList("TRUSTED_PROXIES", nil),
+		IPRulesSource:        getenv("IP_RULES_SOURCE", ""),
+		IdempotencyTTL:       getenvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		OTELCollector:        getenv("OTEL_COLLECTOR_URL", "http://otel-collector:4317"),
+		MetricsExporter:      getenv("METRICS_EXPORTER", "otlp"),
+		AdminAddr:            getenv("ADMIN_ADDR", "127.0.0.1:9464"),
+		TraceSampleRatio:     getenvFloat("TRACE_SAMPLE_RATIO", 1),
+		APIKey:               getenv("API_KEY", ""),
+		APIKeyScopes:         getenvList("API_KEY_SCOPES", []string{"characters:read"}),
+		APIKeyPlan:           getenv("API_KEY_PLAN", "free"),
+		APIKeyCacheTTL:       getenvDuration("API_KEY_CACHE_TTL", 30*time.Second),
+		AdminAPIKey:          getenv("ADMIN_API_KEY", ""),
+		DebugLogSecret:       getenv("DEBUG_LOG_SECRET", ""),
+		APIKeyRotationGrace:  getenvDuration("API_KEY_ROTATION_GRACE", 24*time.Hour),
+		RMAPI:                getenv("RM_API_ENDPOINT", "https://rickandmortyapi.com/api/character"),
+		JWTJWKS:              getenv("JWT_JWKS", ""),
+		JWTJWKSRefresh:       getenvDuration("JWT_JWKS_REFRESH", 15*time.Minute),
+		JWTIssuer:            getenv("JWT_ISSUER", ""),
+		JWTAudience:          getenv("JWT_AUDIENCE", ""),
+		JWTScopeClaim:        getenv("JWT_SCOPE_CLAIM", "scope"),
+		JWTTenantClaim:       getenv("JWT_TENANT_CLAIM", "tenant"),
+		JWTScopeMap:          getenvList("JWT_SCOPE_MAP", nil),
+		JWTPlan:              getenv("JWT_PLAN", "internal"),
+		HMACClientsFile:      getenv("HMAC_CLIENTS_FILE", ""),
+		HMACMaxSkew:          getenvDuration("HMAC_MAX_SKEW", 5*time.Minute),
+	}
+}
+
+const redacted = "REDACTED"
+
+// Redacted returns the configuration keyed by field name with credentials
+// masked, for reporting the effective settings. Fields tagged
+// redact:"secret" are replaced; any other string that looks like a URL
+// keeps its scheme, host and path but loses its credentials and query,
+// which often carry tokens.
+func (c *Config) Redacted() map[string]any {
+	out := map[string]any{}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i).Interface()
+		if s, ok := value.(string); ok && s != "" {
+			if field.Tag.Get("redact") == "secret" {
+				value = redacted
+			} else {
+				value = redactURL(s)
+			}
+		}
+		out[field.Name] = value
 	}
+	return out
+}
+
+// redactURL masks the credentials, query and fragment of s when it is a
+// URL, and all of it when it only resembles one.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		if strings.Contains(s, "://") {
+			return redacted
+		}
+		return s
+	}
+	if u.Host == "" {
+		return s
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); !ok {
+			// A bare user name is often a token.
+			u.User = url.User("xxxxx")
+		}
+	}
+	u.RawQuery, u.ForceQuery, u.Fragment = "", false, ""
+	return u.Redacted()
 }
 
 func getenv(key, def string) string {
@@ -32,3 +204,52 @@ func getenv(key, def string) string {
 	}
 	return def
 }
+
+func getenvDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func getenvFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// getenvList reads a comma-separated list, dropping empty entries.
+func getenvList(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getenvMap reads comma-separated key=value pairs. Entries without "=" are
+// ignored.
+func getenvMap(key string, def map[string]string) map[string]string {
+	items := getenvList(key, nil)
+	if items == nil {
+		return def
+	}
+	out := make(map[string]string, len(items))
+	for _, item := range items {
+		if k, v, ok := strings.Cut(item, "="); ok {
+			out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return out
+}
@@ -15,7 +15,7 @@ import (
 const createCharacter = `-- name: CreateCharacter :one
 INSERT INTO characters (id, name, status, species, type, gender, image, url, created, origin_id, location_id)
 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-RETURNING id, name, status, species, type, gender, image, url, created, origin_id, location_id
+RETURNING id, name, status, species, type, gender, image, url, created, origin_id, location_id, tenant
 `
 
 type CreateCharacterParams struct {
@@ -59,6 +59,7 @@ func (q *Queries) CreateCharacter(ctx context.Context, arg CreateCharacterParams
 		&i.Created,
 		&i.OriginID,
 		&i.LocationID,
+		&i.Tenant,
 	)
 	return i, err
 }
@@ -93,3 +94,235 @@ func (q *Queries) GetMissingCharacterIDs(ctx context.Context, dollar_1 []int32)
 	}
 	return items, nil
 }
+
+const getCharacter = `-- name: GetCharacter :one
+SELECT id, name, status, species, type, gender, image, url, created, origin_id, location_id, tenant FROM characters
+WHERE id = $1 AND (tenant IS NULL OR tenant = $2::text)
+`
+
+type GetCharacterParams struct {
+	ID     int32  `json:"id"`
+	Tenant string `json:"tenant"`
+}
+
+func (q *Queries) GetCharacter(ctx context.Context, arg GetCharacterParams) (Character, error) {
+	row := q.db.QueryRow(ctx, getCharacter,
+		arg.ID,
+		arg.Tenant,
+	)
+	var i Character
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Status,
+		&i.Species,
+		&i.Type,
+		&i.Gender,
+		&i.Image,
+		&i.Url,
+		&i.Created,
+		&i.OriginID,
+		&i.LocationID,
+		&i.Tenant,
+	)
+	return i, err
+}
+
+const createCustomCharacter = `-- name: CreateCustomCharacter :one
+INSERT INTO characters (id, name, status, species, type, gender, image, url, created, tenant)
+VALUES (nextval('custom_character_id_seq'), $1, $2, $3, $4, $5, $6, '', now(), $7::text)
+RETURNING id, name, status, species, type, gender, image, url, created, origin_id, location_id, tenant
+`
+
+type CreateCustomCharacterParams struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Species string `json:"species"`
+	Type    string `json:"type"`
+	Gender  string `json:"gender"`
+	Image   string `json:"image"`
+	Tenant  string `json:"tenant"`
+}
+
+func (q *Queries) CreateCustomCharacter(ctx context.Context, arg CreateCustomCharacterParams) (Character, error) {
+	row := q.db.QueryRow(ctx, createCustomCharacter,
+		arg.Name,
+		arg.Status,
+		arg.Species,
+		arg.Type,
+		arg.Gender,
+		arg.Image,
+		arg.Tenant,
+	)
+	var i Character
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Status,
+		&i.Species,
+		&i.Type,
+		&i.Gender,
+		&i.Image,
+		&i.Url,
+		&i.Created,
+		&i.OriginID,
+		&i.LocationID,
+		&i.Tenant,
+	)
+	return i, err
+}
+
+const listCustomCharacters = `-- name: ListCustomCharacters :many
+SELECT id, name, status, species, type, gender, image, url, created, origin_id, location_id, tenant FROM characters
+WHERE id >= 1000000 AND tenant = $1::text
+ORDER BY id
+`
+
+func (q *Queries) ListCustomCharacters(ctx context.Context, tenant string) ([]Character, error) {
+	rows, err := q.db.Query(ctx, listCustomCharacters, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Character
+	for rows.Next() {
+		var i Character
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Status,
+			&i.Species,
+			&i.Type,
+			&i.Gender,
+			&i.Image,
+			&i.Url,
+			&i.Created,
+			&i.OriginID,
+			&i.LocationID,
+			&i.Tenant,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteCustomCharacter = `-- name: DeleteCustomCharacter :execrows
+DELETE FROM characters
+WHERE id = $1 AND id >= 1000000 AND tenant = $2::text
+`
+
+type DeleteCustomCharacterParams struct {
+	ID     int32  `json:"id"`
+	Tenant string `json:"tenant"`
+}
+
+func (q *Queries) DeleteCustomCharacter(ctx context.Context, arg DeleteCustomCharacterParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCustomCharacter,
+		arg.ID,
+		arg.Tenant,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listCharactersByIDs = `-- name: ListCharactersByIDs :many
+SELECT id, name, status, species, type, gender, image, url, created, origin_id, location_id, tenant FROM characters
+WHERE id = ANY($1::int[]) AND (tenant IS NULL OR tenant = $2::text)
+`
+
+type ListCharactersByIDsParams struct {
+	Ids    []int32 `json:"ids"`
+	Tenant string  `json:"tenant"`
+}
+
+func (q *Queries) ListCharactersByIDs(ctx context.Context, arg ListCharactersByIDsParams) ([]Character, error) {
+	rows, err := q.db.Query(ctx, listCharactersByIDs,
+		arg.Ids,
+		arg.Tenant,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Character
+	for rows.Next() {
+		var i Character
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Status,
+			&i.Species,
+			&i.Type,
+			&i.Gender,
+			&i.Image,
+			&i.Url,
+			&i.Created,
+			&i.OriginID,
+			&i.LocationID,
+			&i.Tenant,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCharactersByTag = `-- name: ListCharactersByTag :many
+SELECT c.id, c.name, c.status, c.species, c.type, c.gender, c.image, c.url, c.created, c.origin_id, c.location_id, c.tenant FROM characters c
+JOIN character_overrides o ON o.character_id = c.id AND o.tenant = $1::text
+WHERE $2::text = ANY(o.tags) AND NOT o.hidden
+  AND (c.tenant IS NULL OR c.tenant = $1::text)
+ORDER BY c.id
+`
+
+type ListCharactersByTagParams struct {
+	Tenant string `json:"tenant"`
+	Tag    string `json:"tag"`
+}
+
+func (q *Queries) ListCharactersByTag(ctx context.Context, arg ListCharactersByTagParams) ([]Character, error) {
+	rows, err := q.db.Query(ctx, listCharactersByTag,
+		arg.Tenant,
+		arg.Tag,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Character
+	for rows.Next() {
+		var i Character
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Status,
+			&i.Species,
+			&i.Type,
+			&i.Gender,
+			&i.Image,
+			&i.Url,
+			&i.Created,
+			&i.OriginID,
+			&i.LocationID,
+			&i.Tenant,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
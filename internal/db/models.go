@@ -5,11 +5,53 @@
 package db
 
 import (
+	"net/netip"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ApiKey struct {
+	ID         int64              `json:"id"`
+	KeyHash    string             `json:"key_hash"`
+	Prefix     string             `json:"prefix"`
+	Owner      string             `json:"owner"`
+	Label      string             `json:"label"`
+	CreatedAt  time.Time          `json:"created_at"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	ReplacedBy pgtype.Int8        `json:"replaced_by"`
+	Scopes     []string           `json:"scopes"`
+	Plan       string             `json:"plan"`
+	UserID     pgtype.Int8        `json:"user_id"`
+	Tenant     string             `json:"tenant"`
+}
+
+type ApiUsage struct {
+	Subject  string      `json:"subject"`
+	Day      pgtype.Date `json:"day"`
+	Endpoint string      `json:"endpoint"`
+	Count    int64       `json:"count"`
+	Tenant   string      `json:"tenant"`
+}
+
+type CharacterOverride struct {
+	CharacterID int32       `json:"character_id"`
+	Nickname    pgtype.Text `json:"nickname"`
+	Tags        []string    `json:"tags"`
+	Hidden      bool        `json:"hidden"`
+	Name        pgtype.Text `json:"name"`
+	Status      pgtype.Text `json:"status"`
+	Species     pgtype.Text `json:"species"`
+	Type        pgtype.Text `json:"type"`
+	Gender      pgtype.Text `json:"gender"`
+	Image       pgtype.Text `json:"image"`
+	UpdatedBy   string      `json:"updated_by"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Tenant      string      `json:"tenant"`
+}
+
 type Character struct {
 	ID         int32       `json:"id"`
 	Name       string      `json:"name"`
@@ -22,4 +64,46 @@ type Character struct {
 	Created    time.Time   `json:"created"`
 	OriginID   pgtype.Int4 `json:"origin_id"`
 	LocationID pgtype.Int4 `json:"location_id"`
+	Tenant     pgtype.Text `json:"tenant"`
+}
+
+type Collection struct {
+	ID          int64     `json:"id"`
+	Owner       string    `json:"owner"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Tenant      string    `json:"tenant"`
+}
+
+type CollectionItem struct {
+	CollectionID int64     `json:"collection_id"`
+	CharacterID  int32     `json:"character_id"`
+	Position     int32     `json:"position"`
+	AddedAt      time.Time `json:"added_at"`
+}
+
+type IpRule struct {
+	ID         int64        `json:"id"`
+	RouteGroup string       `json:"route_group"`
+	Action     string       `json:"action"`
+	Cidr       netip.Prefix `json:"cidr"`
+	Comment    string       `json:"comment"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type User struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	Tenant    string    `json:"tenant"`
+}
+
+type UserFavorite struct {
+	UserID      int64     `json:"user_id"`
+	CharacterID int32     `json:"character_id"`
+	CreatedAt   time.Time `json:"created_at"`
 }
@@ -9,8 +9,50 @@ import (
 )
 
 type Querier interface {
+	AddCollectionItem(ctx context.Context, arg AddCollectionItemParams) (CollectionItem, error)
+	AddUserFavorite(ctx context.Context, arg AddUserFavoriteParams) error
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
 	CreateCharacter(ctx context.Context, arg CreateCharacterParams) (Character, error)
+	CreateCollection(ctx context.Context, arg CreateCollectionParams) (Collection, error)
+	CreateCustomCharacter(ctx context.Context, arg CreateCustomCharacterParams) (Character, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteCharacterOverride(ctx context.Context, arg DeleteCharacterOverrideParams) (int64, error)
+	DeleteCollection(ctx context.Context, arg DeleteCollectionParams) (int64, error)
+	DeleteCustomCharacter(ctx context.Context, arg DeleteCustomCharacterParams) (int64, error)
+	EnsureAPIKey(ctx context.Context, arg EnsureAPIKeyParams) (ApiKey, error)
+	GetAPIKey(ctx context.Context, id int64) (ApiKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetCharacter(ctx context.Context, arg GetCharacterParams) (Character, error)
+	GetCharacterOverride(ctx context.Context, arg GetCharacterOverrideParams) (CharacterOverride, error)
+	GetCollection(ctx context.Context, arg GetCollectionParams) (Collection, error)
 	GetMissingCharacterIDs(ctx context.Context, dollar_1 []int32) ([]int32, error)
+	GetUser(ctx context.Context, arg GetUserParams) (User, error)
+	ListAPIKeys(ctx context.Context) ([]ApiKey, error)
+	ListAPIUsage(ctx context.Context, arg ListAPIUsageParams) ([]ApiUsage, error)
+	ListCharacterOverrides(ctx context.Context, arg ListCharacterOverridesParams) ([]CharacterOverride, error)
+	ListCharactersByIDs(ctx context.Context, arg ListCharactersByIDsParams) ([]Character, error)
+	ListCharactersByTag(ctx context.Context, arg ListCharactersByTagParams) ([]Character, error)
+	ListCollectionItems(ctx context.Context, collectionID int64) ([]CollectionItem, error)
+	ListCollections(ctx context.Context, arg ListCollectionsParams) ([]Collection, error)
+	ListCustomCharacters(ctx context.Context, tenant string) ([]Character, error)
+	ListIPRules(ctx context.Context) ([]IpRule, error)
+	ListUserFavorites(ctx context.Context, userID int64) ([]UserFavorite, error)
+	// Creates the override if there is none and locks it until the transaction
+	// ends, so concurrent patches apply one after the other.
+	LockCharacterOverride(ctx context.Context, arg LockCharacterOverrideParams) (CharacterOverride, error)
+	// Locks the collection until the transaction ends, so concurrent changes
+	// to its item positions apply one after the other.
+	LockCollection(ctx context.Context, arg LockCollectionParams) (Collection, error)
+	ReassignCollections(ctx context.Context, arg ReassignCollectionsParams) (int64, error)
+	RemoveCollectionItem(ctx context.Context, arg RemoveCollectionItemParams) (int64, error)
+	RemoveUserFavorite(ctx context.Context, arg RemoveUserFavoriteParams) (int64, error)
+	ReorderCollectionItems(ctx context.Context, arg ReorderCollectionItemsParams) (int64, error)
+	RevokeAPIKey(ctx context.Context, id int64) (ApiKey, error)
+	RotateOutAPIKey(ctx context.Context, arg RotateOutAPIKeyParams) (ApiKey, error)
+	TouchAPIKey(ctx context.Context, id int64) error
+	UpdateCollection(ctx context.Context, arg UpdateCollectionParams) (Collection, error)
+	UpsertAPIUsage(ctx context.Context, arg UpsertAPIUsageParams) error
+	UpsertCharacterOverride(ctx context.Context, arg UpsertCharacterOverrideParams) (CharacterOverride, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,38 @@
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1;
+
+-- name: EnsureAPIKey :one
+INSERT INTO api_keys (key_hash, prefix, owner, label, scopes, plan)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (key_hash) DO UPDATE SET scopes = EXCLUDED.scopes, plan = EXCLUDED.plan
+RETURNING *;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys SET last_used_at = now()
+WHERE id = $1;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (key_hash, prefix, owner, label, expires_at, scopes, plan, user_id, tenant)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetAPIKey :one
+SELECT * FROM api_keys
+WHERE id = $1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+ORDER BY id;
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now())
+WHERE id = $1
+RETURNING *;
+
+-- name: RotateOutAPIKey :one
+UPDATE api_keys
+SET expires_at = LEAST(COALESCE(expires_at, sqlc.arg(expires_at)::timestamptz), sqlc.arg(expires_at)::timestamptz),
+    replaced_by = sqlc.arg(replaced_by)
+WHERE id = sqlc.arg(id) AND replaced_by IS NULL AND revoked_at IS NULL
+RETURNING *;
@@ -0,0 +1,36 @@
+-- name: GetCharacterOverride :one
+SELECT * FROM character_overrides
+WHERE tenant = $1 AND character_id = $2;
+
+-- name: LockCharacterOverride :one
+-- Creates the override if there is none and locks it until the transaction
+-- ends, so concurrent patches apply one after the other.
+INSERT INTO character_overrides (tenant, character_id)
+VALUES ($1, $2)
+ON CONFLICT (tenant, character_id) DO UPDATE SET tenant = EXCLUDED.tenant
+RETURNING *;
+
+-- name: ListCharacterOverrides :many
+SELECT * FROM character_overrides
+WHERE tenant = sqlc.arg(tenant) AND character_id = ANY(sqlc.arg(character_ids)::int[]);
+
+-- name: UpsertCharacterOverride :one
+INSERT INTO character_overrides (tenant, character_id, nickname, tags, hidden, name, status, species, type, gender, image, updated_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (tenant, character_id) DO UPDATE SET
+    nickname = EXCLUDED.nickname,
+    tags = EXCLUDED.tags,
+    hidden = EXCLUDED.hidden,
+    name = EXCLUDED.name,
+    status = EXCLUDED.status,
+    species = EXCLUDED.species,
+    type = EXCLUDED.type,
+    gender = EXCLUDED.gender,
+    image = EXCLUDED.image,
+    updated_by = EXCLUDED.updated_by,
+    updated_at = now()
+RETURNING *;
+
+-- name: DeleteCharacterOverride :execrows
+DELETE FROM character_overrides
+WHERE tenant = $1 AND character_id = $2;
@@ -11,4 +11,33 @@ SELECT id::int4 AS id
 FROM input_ids
 WHERE id NOT IN (
     SELECT id FROM characters
-);
\ No newline at end of file
+);
+
+-- name: GetCharacter :one
+SELECT * FROM characters
+WHERE id = sqlc.arg(id) AND (tenant IS NULL OR tenant = sqlc.arg(tenant)::text);
+
+-- name: CreateCustomCharacter :one
+INSERT INTO characters (id, name, status, species, type, gender, image, url, created, tenant)
+VALUES (nextval('custom_character_id_seq'), $1, $2, $3, $4, $5, $6, '', now(), $7::text)
+RETURNING *;
+
+-- name: ListCustomCharacters :many
+SELECT * FROM characters
+WHERE id >= 1000000 AND tenant = sqlc.arg(tenant)::text
+ORDER BY id;
+
+-- name: DeleteCustomCharacter :execrows
+DELETE FROM characters
+WHERE id = sqlc.arg(id) AND id >= 1000000 AND tenant = sqlc.arg(tenant)::text;
+
+-- name: ListCharactersByIDs :many
+SELECT * FROM characters
+WHERE id = ANY(sqlc.arg(ids)::int[]) AND (tenant IS NULL OR tenant = sqlc.arg(tenant)::text);
+
+-- name: ListCharactersByTag :many
+SELECT c.* FROM characters c
+JOIN character_overrides o ON o.character_id = c.id AND o.tenant = sqlc.arg(tenant)::text
+WHERE sqlc.arg(tag)::text = ANY(o.tags) AND NOT o.hidden
+  AND (c.tenant IS NULL OR c.tenant = sqlc.arg(tenant)::text)
+ORDER BY c.id;
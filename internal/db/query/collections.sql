@@ -0,0 +1,58 @@
+-- name: CreateCollection :one
+INSERT INTO collections (tenant, owner, name, description, tags)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetCollection :one
+SELECT * FROM collections
+WHERE id = $1 AND tenant = $2 AND owner = $3;
+
+-- name: LockCollection :one
+-- Locks the collection until the transaction ends, so concurrent changes
+-- to its item positions apply one after the other.
+SELECT * FROM collections
+WHERE id = $1 AND tenant = $2 AND owner = $3
+FOR UPDATE;
+
+-- name: ListCollections :many
+SELECT * FROM collections
+WHERE tenant = sqlc.arg(tenant) AND owner = sqlc.arg(owner)
+  AND (sqlc.arg(tag)::text = '' OR sqlc.arg(tag)::text = ANY(tags))
+ORDER BY name;
+
+-- name: UpdateCollection :one
+UPDATE collections
+SET name = $4, description = $5, tags = $6, updated_at = now()
+WHERE id = $1 AND tenant = $2 AND owner = $3
+RETURNING *;
+
+-- name: DeleteCollection :execrows
+DELETE FROM collections
+WHERE id = $1 AND tenant = $2 AND owner = $3;
+
+-- name: ListCollectionItems :many
+SELECT * FROM collection_items
+WHERE collection_id = $1
+ORDER BY position, added_at;
+
+-- name: AddCollectionItem :one
+INSERT INTO collection_items (collection_id, character_id, position)
+SELECT $1, $2, COALESCE(MAX(position) + 1, 0)
+FROM collection_items
+WHERE collection_id = $1
+ON CONFLICT (collection_id, character_id) DO NOTHING
+RETURNING *;
+
+-- name: RemoveCollectionItem :execrows
+DELETE FROM collection_items
+WHERE collection_id = $1 AND character_id = $2;
+
+-- name: ReorderCollectionItems :execrows
+UPDATE collection_items ci
+SET position = o.position - 1
+FROM UNNEST(sqlc.arg(character_ids)::int[]) WITH ORDINALITY AS o(character_id, position)
+WHERE ci.collection_id = sqlc.arg(collection_id) AND ci.character_id = o.character_id;
+
+-- name: ReassignCollections :execrows
+UPDATE collections SET owner = sqlc.arg(new_owner), updated_at = now()
+WHERE tenant = sqlc.arg(tenant) AND owner = sqlc.arg(old_owner);
@@ -0,0 +1,3 @@
+-- name: ListIPRules :many
+SELECT * FROM ip_rules
+ORDER BY route_group, id;
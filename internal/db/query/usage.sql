@@ -0,0 +1,9 @@
+-- name: UpsertAPIUsage :exec
+INSERT INTO api_usage (tenant, subject, day, endpoint, count)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (tenant, subject, day, endpoint) DO UPDATE SET count = EXCLUDED.count;
+
+-- name: ListAPIUsage :many
+SELECT * FROM api_usage
+WHERE tenant = $1 AND subject = $2 AND day BETWEEN sqlc.arg(from_day) AND sqlc.arg(to_day)
+ORDER BY day, endpoint;
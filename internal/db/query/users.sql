@@ -0,0 +1,22 @@
+-- name: CreateUser :one
+INSERT INTO users (tenant, name, email)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1 AND tenant = $2;
+
+-- name: ListUserFavorites :many
+SELECT * FROM user_favorites
+WHERE user_id = $1
+ORDER BY created_at, character_id;
+
+-- name: AddUserFavorite :exec
+INSERT INTO user_favorites (user_id, character_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, character_id) DO NOTHING;
+
+-- name: RemoveUserFavorite :execrows
+DELETE FROM user_favorites
+WHERE user_id = $1 AND character_id = $2;
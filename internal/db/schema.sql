@@ -9,5 +9,151 @@ CREATE TABLE IF NOT EXISTS characters (
     url TEXT,
     created TIMESTAMPTZ NOT NULL,
     origin_id INT,
-    location_id INT
-);
\ No newline at end of file
+    location_id INT,
+    -- Set for custom characters, which only their tenant can see; upstream
+    -- characters are shared by every tenant.
+    tenant TEXT
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    tenant TEXT NOT NULL DEFAULT 'default',
+    UNIQUE (tenant, email)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    key_hash TEXT NOT NULL UNIQUE,
+    prefix TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    label TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    replaced_by BIGINT REFERENCES api_keys(id),
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    plan TEXT NOT NULL DEFAULT 'free',
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    tenant TEXT NOT NULL DEFAULT 'default'
+);
+
+CREATE TABLE IF NOT EXISTS api_usage (
+    subject TEXT NOT NULL,
+    day DATE NOT NULL,
+    endpoint TEXT NOT NULL,
+    count BIGINT NOT NULL,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    PRIMARY KEY (tenant, subject, day, endpoint)
+);
+
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id BIGSERIAL PRIMARY KEY,
+    route_group TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('allow', 'deny')),
+    cidr CIDR NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Upstream character IDs stay far below this; locally created characters
+-- are numbered from here so syncing from upstream never touches them.
+CREATE SEQUENCE IF NOT EXISTS custom_character_id_seq
+    START WITH 1000000 MINVALUE 1000000 MAXVALUE 2147483647;
+
+CREATE TABLE IF NOT EXISTS character_overrides (
+    character_id INT NOT NULL,
+    nickname TEXT,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    hidden BOOLEAN NOT NULL DEFAULT false,
+    name TEXT,
+    status TEXT,
+    species TEXT,
+    type TEXT,
+    gender TEXT,
+    image TEXT,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    tenant TEXT NOT NULL DEFAULT 'default',
+    PRIMARY KEY (tenant, character_id)
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+    id BIGSERIAL PRIMARY KEY,
+    owner TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    tenant TEXT NOT NULL DEFAULT 'default',
+    UNIQUE (tenant, owner, name)
+);
+
+CREATE TABLE IF NOT EXISTS collection_items (
+    collection_id BIGINT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    character_id INT NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (collection_id, character_id)
+);
+
+CREATE INDEX IF NOT EXISTS character_overrides_tags_idx ON character_overrides USING GIN (tags);
+
+CREATE TABLE IF NOT EXISTS user_favorites (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    character_id INT NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, character_id)
+);
+
+
+-- Upgrades existing databases. The CREATE TABLE statements above only apply
+-- to new databases, so every column and key added to a table after it was
+-- first created is repeated here in a form that is safe to re-run.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS replaced_by BIGINT REFERENCES api_keys(id);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS plan TEXT NOT NULL DEFAULT 'free';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE characters ADD COLUMN IF NOT EXISTS tenant TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_usage ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE character_overrides ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT 'default';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_tenant_email_key') THEN
+        ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+        ALTER TABLE users ADD CONSTRAINT users_tenant_email_key UNIQUE (tenant, email);
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'collections_tenant_owner_name_key') THEN
+        ALTER TABLE collections DROP CONSTRAINT IF EXISTS collections_owner_name_key;
+        ALTER TABLE collections ADD CONSTRAINT collections_tenant_owner_name_key UNIQUE (tenant, owner, name);
+    END IF;
+
+    -- Primary keys keep their name, so check whether tenant is part of them.
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint c
+        JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY (c.conkey)
+        WHERE c.conname = 'api_usage_pkey' AND a.attname = 'tenant'
+    ) THEN
+        ALTER TABLE api_usage DROP CONSTRAINT IF EXISTS api_usage_pkey;
+        ALTER TABLE api_usage ADD PRIMARY KEY (tenant, subject, day, endpoint);
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint c
+        JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY (c.conkey)
+        WHERE c.conname = 'character_overrides_pkey' AND a.attname = 'tenant'
+    ) THEN
+        ALTER TABLE character_overrides DROP CONSTRAINT IF EXISTS character_overrides_pkey;
+        ALTER TABLE character_overrides ADD PRIMARY KEY (tenant, character_id);
+    END IF;
+END $$;
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store is a Querier backed by a pool that can also run several queries in
+// one transaction.
+type Store struct {
+	*Queries
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{Queries: New(pool), pool: pool}
+}
+
+// InTx runs fn with queries bound to a single transaction, committing when
+// fn returns nil and rolling back otherwise.
+func (s *Store) InTx(ctx context.Context, fn func(Querier) error) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return fn(s.WithTx(tx))
+	})
+}
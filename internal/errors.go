@@ -1,12 +1,22 @@
 package internal
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/rs/zerolog"
+)
 
 // Error represents a custom error with a code and message.
 type Error struct {
 	Code    string
 	Message string
 	Err     error
+	// Fields carries structured context (entity, id, upstream status...)
+	// that is emitted alongside the error when it is logged.
+	Fields map[string]any
 }
 
 // Error returns the string representation of the error.
@@ -17,10 +27,73 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("code=%s, message=%s", e.Code, e.Message)
 }
 
-// Wrap wraps an existing error with a new error.
+// Unwrap returns the wrapped cause so errors.Is and errors.As can inspect it.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same code, which makes the
+// sentinel values below usable with errors.Is.
+func (e *Error) Is(target error) bool {
+	//nolint:errorlint
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Code == e.Code
+}
+
+// WithField returns a copy of the error with the given field set.
+func (e *Error) WithField(key string, value any) *Error {
+	return e.WithFields(map[string]any{key: value})
+}
+
+// WithFields returns a copy of the error with the given fields merged in.
+func (e *Error) WithFields(fields map[string]any) *Error {
+	c := e.clone()
+	for k, v := range fields {
+		c.Fields[k] = v
+	}
+	return c
+}
+
+// HTTPStatus returns the HTTP status code suggested by the error code.
+func (e *Error) HTTPStatus() int {
+	switch e.Code {
+	case ErrorCodeNotFound:
+		return http.StatusNotFound
+	case ErrorCodeUnauthorized:
+		return http.StatusUnauthorized
+	case ErrorCodeForbidden:
+		return http.StatusForbidden
+	case ErrorCodeInvalidArgument:
+		return http.StatusBadRequest
+	case ErrorCodeRateLimited:
+		return http.StatusTooManyRequests
+	case ErrorCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrorCodeConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (e *Error) clone() *Error {
+	c := *e
+	c.Fields = make(map[string]any, len(e.Fields))
+	for k, v := range e.Fields {
+		c.Fields[k] = v
+	}
+	return &c
+}
+
+// Wrap returns a copy of newErr with err set as its cause. newErr itself is
+// left untouched so shared values can be wrapped safely.
 func Wrap(err error, newErr *Error) *Error {
-	newErr.Err = err
-	return newErr
+	c := newErr.clone()
+	c.Err = err
+	return c
 }
 
 // NewError creates a new Error.
@@ -28,10 +101,85 @@ func NewError(code, message string) *Error {
 	return &Error{Code: code, Message: message}
 }
 
+// HTTPStatus returns the HTTP status suggested by the first *Error in err's
+// chain, or 500 if there is none.
+func HTTPStatus(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.HTTPStatus()
+	}
+	return http.StatusInternalServerError
+}
+
+// Code returns the code of the first *Error in err's chain, or
+// ErrorCodeInternal if there is none. Unlike the message it is bounded, so
+// it suits metric attributes.
+func Code(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrorCodeInternal
+}
+
+// LogError returns an error-level event on l populated with err, its code and
+// every field found along the wrap chain. Callers finish it with Msg.
+func LogError(l *zerolog.Logger, err error) *zerolog.Event {
+	ev := l.Error().Err(err)
+
+	var e *Error
+	if !errors.As(err, &e) {
+		return ev
+	}
+	ev = ev.Str("error_code", e.Code)
+
+	fields := map[string]any{}
+	for cur := error(e); cur != nil; cur = errors.Unwrap(cur) {
+		//nolint:errorlint
+		ce, ok := cur.(*Error)
+		if !ok {
+			continue
+		}
+		for k, v := range ce.Fields {
+			// Outer errors take precedence over their causes.
+			if _, seen := fields[k]; !seen {
+				fields[k] = v
+			}
+		}
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ev = ev.Interface(k, fields[k])
+	}
+	return ev
+}
+
 // Error codes
 const (
-	ErrorCodeUnknown      = "unknown"
-	ErrorCodeNotFound     = "not_found"
-	ErrorCodeInternal     = "internal"
-	ErrorCodeUnauthorized = "unauthorized"
+	ErrorCodeUnknown         = "unknown"
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeInternal        = "internal"
+	ErrorCodeUnauthorized    = "unauthorized"
+	ErrorCodeForbidden       = "forbidden"
+	ErrorCodeInvalidArgument = "invalid_argument"
+	ErrorCodeRateLimited     = "rate_limited"
+	ErrorCodeUnavailable     = "unavailable"
+	ErrorCodeConflict        = "conflict"
+)
+
+// Sentinel errors for use with errors.Is. Any *Error with the same code
+// matches, regardless of message or fields.
+var (
+	ErrNotFound        = NewError(ErrorCodeNotFound, "not found")
+	ErrInternal        = NewError(ErrorCodeInternal, "internal error")
+	ErrUnauthorized    = NewError(ErrorCodeUnauthorized, "unauthorized")
+	ErrForbidden       = NewError(ErrorCodeForbidden, "forbidden")
+	ErrInvalidArgument = NewError(ErrorCodeInvalidArgument, "invalid argument")
+	ErrRateLimited     = NewError(ErrorCodeRateLimited, "rate limited")
+	ErrUnavailable     = NewError(ErrorCodeUnavailable, "unavailable")
+	ErrConflict        = NewError(ErrorCodeConflict, "conflict")
 )
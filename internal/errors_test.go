@@ -0,0 +1,58 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"aka-project/internal"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap_DoesNotMutateAndUnwraps(t *testing.T) {
+	cause := errors.New("connection refused")
+	base := internal.NewError(internal.ErrorCodeUnavailable, "db down")
+
+	wrapped := internal.Wrap(cause, base)
+
+	assert.Nil(t, base.Err)
+	assert.ErrorIs(t, wrapped, cause)
+	assert.ErrorIs(t, wrapped, internal.ErrUnavailable)
+	assert.NotErrorIs(t, wrapped, internal.ErrNotFound)
+}
+
+func TestErrorIs_MatchesCodeAcrossChain(t *testing.T) {
+	inner := internal.NewError(internal.ErrorCodeNotFound, "upstream 404")
+	outer := internal.Wrap(inner, internal.NewError(internal.ErrorCodeInternal, "failed to fetch"))
+
+	assert.ErrorIs(t, outer, internal.ErrNotFound)
+	assert.ErrorIs(t, outer, internal.ErrInternal)
+	assert.Equal(t, http.StatusInternalServerError, internal.HTTPStatus(outer))
+	assert.Equal(t, http.StatusNotFound, internal.HTTPStatus(inner))
+	assert.Equal(t, http.StatusInternalServerError, internal.HTTPStatus(errors.New("plain")))
+	assert.Equal(t, internal.ErrorCodeInternal, internal.Code(outer))
+	assert.Equal(t, internal.ErrorCodeNotFound, internal.Code(inner))
+	assert.Equal(t, internal.ErrorCodeInternal, internal.Code(errors.New("plain")))
+}
+
+func TestLogError_EmitsFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := zerolog.New(&buf)
+
+	inner := internal.NewError(internal.ErrorCodeNotFound, "missing").WithField("upstream_status", 404)
+	err := internal.Wrap(inner, internal.NewError(internal.ErrorCodeInternal, "failed").
+		WithFields(map[string]any{"entity": "character", "id": 7}))
+
+	internal.LogError(&l, err).Msg("boom")
+
+	var out map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "internal", out["error_code"])
+	assert.Equal(t, "character", out["entity"])
+	assert.EqualValues(t, 7, out["id"])
+	assert.EqualValues(t, 404, out["upstream_status"])
+}
@@ -0,0 +1,290 @@
+// Package health runs the dependency checks behind the readiness probe.
+// Subsystems register a Checker with a Registry, which runs every check
+// concurrently under its own timeout and caches the report briefly so
+// frequent probes do not hammer the dependencies. Non-critical checks that
+// may take longer than the registry's timeout run in the background, so a
+// probe never waits for them.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK = "ok"
+	// StatusDegraded means only non-critical checks are failing: the
+	// instance keeps serving, with some features impaired.
+	StatusDegraded = "degraded"
+	StatusError    = "error"
+	// StatusPending is reported by a background check that has not
+	// finished its first run.
+	StatusPending = "pending"
+)
+
+// Checker reports whether a dependency is usable; a nil error means
+// healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// Check registers a Checker under a name.
+type Check struct {
+	Name    string
+	Checker Checker
+	// Critical checks fail readiness; failing non-critical ones only
+	// degrade it.
+	Critical bool
+	// Timeout overrides the registry's default timeout for this check. A
+	// longer one makes a non-critical check run in the background; critical
+	// checks may not exceed the registry's timeout.
+	Timeout time.Duration
+	// TTL, when longer than the registry's, reuses this check's last
+	// result for that long, e.g. to probe a third-party API less often.
+	TTL time.Duration
+}
+
+// Result is the outcome of the latest run of one check.
+type Result struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// LastError and LastErrorAt survive recovery so flapping dependencies
+	// remain visible.
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// Report is the outcome of running every registered check.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Registry holds the registered checks and the last report.
+type Registry struct {
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu         sync.Mutex
+	checks     []Check
+	last       map[string]Result
+	refreshing map[string]bool
+	report     Report
+	ranAt      time.Time
+}
+
+// NewRegistry returns a registry whose checks time out after timeout unless
+// they set their own, and whose reports are reused for ttl. Run waits at
+// most about timeout, so it must stay below the readiness probe's timeout.
+func NewRegistry(timeout, ttl time.Duration) *Registry {
+	return &Registry{
+		timeout:    timeout,
+		ttl:        ttl,
+		last:       map[string]Result{},
+		refreshing: map[string]bool{},
+	}
+}
+
+// Register adds a check. It panics on a duplicate or empty name, or on a
+// critical check with a timeout longer than the registry's, which are
+// wiring mistakes.
+func (r *Registry) Register(c Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c.Name == "" || c.Checker == nil {
+		panic("health: check needs a name and a checker")
+	}
+	if c.Critical && c.Timeout > r.timeout {
+		panic(fmt.Sprintf("health: critical check %q may not outlast the registry timeout", c.Name))
+	}
+	for _, existing := range r.checks {
+		if existing.Name == c.Name {
+			panic(fmt.Sprintf("health: check %q registered twice", c.Name))
+		}
+	}
+	r.checks = append(r.checks, c)
+	r.ranAt = time.Time{}
+}
+
+// Run returns the current report, running the checks if the cached one is
+// older than the TTL. Concurrent callers share a single run. Background
+// checks contribute their last result and are refreshed after Run returns.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.ranAt.IsZero() && time.Since(r.ranAt) < r.ttl {
+		return r.report
+	}
+
+	// Callers share the result, so one caller going away must not fail
+	// the checks for the others.
+	ctx = context.WithoutCancel(ctx)
+
+	results := make([]Result, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		if prev, ok := r.last[c.Name]; ok && time.Since(prev.CheckedAt) < c.TTL {
+			results[i] = prev
+			continue
+		}
+		if r.background(c) {
+			results[i] = r.refresh(ctx, c)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.runOne(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(results))}
+	for i, c := range r.checks {
+		res := results[i]
+		if res.Status != StatusPending {
+			res = r.record(c, res)
+		}
+		report.Checks[c.Name] = res
+
+		switch {
+		case res.Status == StatusOK, res.Status == StatusPending:
+		case c.Critical:
+			report.Status = StatusError
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	r.report, r.ranAt = report, time.Now()
+	return report
+}
+
+// record keeps res as the last result of c, carrying over the last error
+// when the check has recovered. r.mu must be held.
+func (r *Registry) record(c Check, res Result) Result {
+	if res.Error != "" {
+		at := res.CheckedAt
+		res.LastError, res.LastErrorAt = res.Error, &at
+	} else if prev, ok := r.last[c.Name]; ok {
+		res.LastError, res.LastErrorAt = prev.LastError, prev.LastErrorAt
+	}
+	r.last[c.Name] = res
+	return res
+}
+
+// background reports whether c may take longer than a probe should wait.
+func (r *Registry) background(c Check) bool {
+	return !c.Critical && c.Timeout > r.timeout
+}
+
+// refresh starts running c in the background unless it already is, and
+// returns its last result meanwhile. r.mu must be held.
+func (r *Registry) refresh(ctx context.Context, c Check) Result {
+	if !r.refreshing[c.Name] {
+		r.refreshing[c.Name] = true
+		go func() {
+			res := r.runOne(ctx, c)
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.refreshing, c.Name)
+			r.record(c, res)
+		}()
+	}
+	if prev, ok := r.last[c.Name]; ok {
+		return prev
+	}
+	return Result{Status: StatusPending, Critical: c.Critical}
+}
+
+func (r *Registry) runOne(ctx context.Context, c Check) Result {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Checker.Check(ctx)
+	res := Result{
+		Status:    StatusOK,
+		Critical:  c.Critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		res.Status = StatusError
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// HTTPChecker probes an HTTP endpoint and fails on transport errors, 5xx
+// and 429 responses.
+type HTTPChecker struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h HTTPChecker) Check(ctx context.Context) error {
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FreshnessChecker fails when the last success reported by Last is older
+// than MaxAge. Before the first success the age is measured from when the
+// checker was created, so a freshly started instance is not flagged
+// straight away.
+type FreshnessChecker struct {
+	Last   func() time.Time
+	MaxAge time.Duration
+	since  time.Time
+}
+
+func NewFreshnessChecker(last func() time.Time, maxAge time.Duration) *FreshnessChecker {
+	return &FreshnessChecker{Last: last, MaxAge: maxAge, since: time.Now()}
+}
+
+func (f *FreshnessChecker) Check(ctx context.Context) error {
+	last := f.Last()
+	if last.IsZero() {
+		if age := time.Since(f.since); age > f.MaxAge {
+			return fmt.Errorf("no successful sync in %s", age.Round(time.Second))
+		}
+		return nil
+	}
+	if age := time.Since(last); age > f.MaxAge {
+		return fmt.Errorf("last successful sync %s ago", age.Round(time.Second))
+	}
+	return nil
+}
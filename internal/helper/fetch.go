@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"time"
 
+	"aka-project/internal"
+
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -69,9 +71,19 @@ func FetchPage(ctx context.Context, url string) (*APIResponse, error) {
 	if err != nil {
 		span.RecordError(err)
 		span.SetAttributes(attribute.String("fetch.final_error", err.Error()))
-		return nil, err
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeUnavailable, "upstream request failed").
+			WithField("upstream_url", url))
 	}
 	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, internal.NewError(internal.ErrorCodeNotFound, "upstream returned no results").
+			WithFields(map[string]any{"upstream_url": url, "upstream_status": resp.StatusCode})
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, internal.NewError(internal.ErrorCodeUnavailable, "upstream unavailable").
+			WithFields(map[string]any{"upstream_url": url, "upstream_status": resp.StatusCode})
+	}
 	body, _ := io.ReadAll(resp.Body)
 
 	var apiResp APIResponse
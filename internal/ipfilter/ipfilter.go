@@ -0,0 +1,218 @@
+// Package ipfilter decides whether client addresses may reach a route group
+// based on CIDR allow and deny rules.
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync/atomic"
+
+	"aka-project/internal/db"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ReloadChannel is the Redis pub/sub channel that makes every replica
+// reload its rules, for example after editing the ip_rules table:
+//
+//	PUBLISH ip_rules:reload 1
+const ReloadChannel = "ip_rules:reload"
+
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+	// GroupAll rules apply to every route group.
+	GroupAll = "*"
+)
+
+// Rule allows or denies a network for a route group.
+type Rule struct {
+	ID      int64        `json:"id,omitempty"`
+	Group   string       `json:"group"`
+	Action  string       `json:"action"`
+	CIDR    netip.Prefix `json:"cidr"`
+	Comment string       `json:"comment"`
+}
+
+// String describes the rule for logs.
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s %s %s", r.Group, r.Action, r.CIDR)
+	if r.Comment != "" {
+		s += " (" + r.Comment + ")"
+	}
+	return s
+}
+
+// Source loads the current rule set.
+type Source interface {
+	Load(ctx context.Context) ([]Rule, error)
+}
+
+// FileSource reads rules from a JSON array of Rule.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Load(ctx context.Context) ([]Rule, error) {
+	raw, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// DBSource reads rules from the ip_rules table.
+type DBSource struct {
+	Queries db.Querier
+}
+
+func (s DBSource) Load(ctx context.Context) ([]Rule, error) {
+	rows, err := s.Queries.ListIPRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]Rule, 0, len(rows))
+	for _, row := range rows {
+		rules = append(rules, Rule{
+			ID:      row.ID,
+			Group:   row.RouteGroup,
+			Action:  row.Action,
+			CIDR:    row.Cidr,
+			Comment: row.Comment,
+		})
+	}
+	return rules, nil
+}
+
+// Decision is the outcome of checking an address. Rule is the rule that
+// matched; it is the zero Rule when a group with allow rules rejected an
+// address none of them matched.
+type Decision struct {
+	Allowed bool
+	Rule    Rule
+	Matched bool
+}
+
+type ruleset map[string][]Rule
+
+// Filter holds the active rules and swaps them atomically on reload.
+type Filter struct {
+	source  Source
+	rules   atomic.Pointer[ruleset]
+	blocked metric.Int64Counter
+}
+
+// New loads the initial rules from source and fails if they are invalid.
+func New(ctx context.Context, source Source, meter metric.Meter) (*Filter, error) {
+	blocked, err := meter.Int64Counter(
+		"ip_filter.blocked_total",
+		metric.WithDescription("Requests rejected by IP allow/deny rules"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	f := &Filter{source: source, blocked: blocked}
+	if err := f.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload replaces the active rules. On error the previous rules stay in
+// force.
+func (f *Filter) Reload(ctx context.Context) error {
+	rules, err := f.source.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load ip rules: %w", err)
+	}
+	set := ruleset{}
+	for _, r := range rules {
+		if r.Action != ActionAllow && r.Action != ActionDeny {
+			return fmt.Errorf("ip rule %s: unknown action %q", r, r.Action)
+		}
+		if !r.CIDR.IsValid() || r.Group == "" {
+			return fmt.Errorf("ip rule %s: group and cidr are required", r)
+		}
+		if a := r.CIDR.Addr(); a.Is4In6() && r.CIDR.Bits() >= 96 {
+			r.CIDR = netip.PrefixFrom(a.Unmap(), r.CIDR.Bits()-96)
+		}
+		r.CIDR = r.CIDR.Masked()
+		set[r.Group] = append(set[r.Group], r)
+	}
+	f.rules.Store(&set)
+	log.Info().Int("rules", len(rules)).Msg("ip rules loaded")
+	return nil
+}
+
+// Check decides whether addr may reach group. Deny rules win over allow
+// rules, and rules for GroupAll apply to every group. A group with any
+// allow rules only admits addresses matching one of them.
+func (f *Filter) Check(ctx context.Context, group string, addr netip.Addr) Decision {
+	set := *f.rules.Load()
+	addr = addr.Unmap()
+	rules := append(append([]Rule{}, set[GroupAll]...), set[group]...)
+
+	allowList := false
+	for _, r := range rules {
+		if r.Action == ActionDeny && r.CIDR.Contains(addr) {
+			return f.block(ctx, group, Decision{Rule: r, Matched: true})
+		}
+	}
+	for _, r := range rules {
+		if r.Action != ActionAllow {
+			continue
+		}
+		allowList = true
+		if r.CIDR.Contains(addr) {
+			return Decision{Allowed: true, Rule: r, Matched: true}
+		}
+	}
+	if allowList {
+		return f.block(ctx, group, Decision{})
+	}
+	return Decision{Allowed: true}
+}
+
+func (f *Filter) block(ctx context.Context, group string, d Decision) Decision {
+	rule := "default"
+	if d.Matched {
+		rule = d.Rule.Action + " " + d.Rule.CIDR.String()
+	}
+	f.blocked.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("group", group),
+		attribute.String("rule", rule),
+	))
+	return d
+}
+
+// Subscribe reloads the rules whenever a message arrives on ReloadChannel,
+// until ctx is done.
+func (f *Filter) Subscribe(ctx context.Context, rdb *redis.Client) {
+	pubsub := rdb.Subscribe(ctx, ReloadChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := f.Reload(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to reload ip rules, keeping previous rules")
+			}
+		}
+	}
+}
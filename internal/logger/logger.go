@@ -1,13 +1,74 @@
 package logger
 
 import (
+	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-func New() {
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	log.Logger = log.Output(os.Stdout)
+// level is the default minimum level. It is enforced by levelGate on the
+// global logger's output rather than by zerolog's global level, which is a
+// floor no request could go below, so runtime changes reach every logger
+// derived from the global one without replacing it.
+var level atomic.Int32
+
+// out is the writer behind the gate, which Debug loggers write to directly.
+var out io.Writer = os.Stdout
+
+// New configures the global logger at the given level, such as "info" or
+// "debug". An unknown level falls back to info and is reported as an error.
+func New(lvl string) error {
+	return NewWriter(lvl, os.Stdout)
+}
+
+// NewWriter is New with the logs written to w. It must only be called
+// before the logger is in use.
+func NewWriter(lvl string, w io.Writer) error {
+	parsed, err := zerolog.ParseLevel(lvl)
+	if err != nil || lvl == "" {
+		parsed = zerolog.InfoLevel
+	}
+	SetLevel(parsed)
+	out = w
+	log.Logger = zerolog.New(levelGate{w: w}).With().Timestamp().Logger()
+	return err
+}
+
+// Level returns the default minimum level.
+func Level() zerolog.Level {
+	return zerolog.Level(level.Load())
+}
+
+// SetLevel changes the default minimum level for the global logger and
+// every logger derived from it, including those of requests in flight.
+func SetLevel(l zerolog.Level) {
+	level.Store(int32(l))
+}
+
+// Debug returns a copy of l that writes debug events whatever the default
+// level. A disabled logger is returned as is.
+func Debug(l zerolog.Logger) zerolog.Logger {
+	if l.GetLevel() == zerolog.Disabled {
+		return l
+	}
+	return l.Output(out).Level(zerolog.DebugLevel)
+}
+
+// levelGate drops events below the default level.
+type levelGate struct {
+	w io.Writer
+}
+
+func (g levelGate) Write(p []byte) (int, error) {
+	return g.w.Write(p)
+}
+
+func (g levelGate) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	if l < Level() {
+		return len(p), nil
+	}
+	return g.w.Write(p)
 }
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/tenant"
+
+	"github.com/rs/zerolog"
+)
+
+// Authenticator resolves the caller of a request from one kind of
+// credential. It returns auth.ErrNoCredentials when the request carries
+// none of its kind.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*auth.Identity, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(r *http.Request) (*auth.Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*auth.Identity, error) {
+	return f(r)
+}
+
+// RequireAuth authenticates requests with the first authenticator that
+// finds credentials of its kind, so a route can accept several methods.
+// Requests with no recognised credentials are rejected.
+func RequireAuth(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			for _, a := range authenticators {
+				id, err := a.Authenticate(r)
+				if errors.Is(err, auth.ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					status := internal.HTTPStatus(err)
+					switch {
+					case errors.Is(err, internal.ErrUnauthorized):
+						zerolog.Ctx(ctx).Debug().Err(err).Msg("authentication rejected")
+						http.Error(w, "unauthorized", http.StatusUnauthorized)
+					case status < http.StatusInternalServerError:
+						http.Error(w, strings.ToLower(http.StatusText(status)), status)
+					default:
+						internal.LogError(zerolog.Ctx(ctx), err).Msg("failed to authenticate request")
+						http.Error(w, "internal error", status)
+					}
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withIdentity(ctx, id)))
+				return
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
+
+// JWTAuth authenticates "Authorization: Bearer" tokens.
+func JWTAuth(v *auth.JWTVerifier) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*auth.Identity, error) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, auth.ErrNoCredentials
+		}
+		return v.Verify(r.Context(), strings.TrimSpace(token))
+	})
+}
+
+// withIdentity stores id and its tenant in ctx and tags the request logger
+// with them so the access log line carries the caller.
+func withIdentity(ctx context.Context, id *auth.Identity) context.Context {
+	if id.Tenant == "" {
+		id.Tenant = tenant.Default
+	}
+	zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("tenant", id.Tenant).Str("auth_method", id.Method).Str("auth_subject", id.Key()).Str("auth_owner", id.Owner)
+	})
+	return tenant.WithTenant(auth.WithIdentity(ctx, id), id.Tenant)
+}
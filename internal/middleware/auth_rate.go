@@ -4,56 +4,204 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/ulule/limiter/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // Rate limit middleware
 
+// RateLimit enforces the caller's plan. It must run after authentication
+// and inside the router so the matched route pattern is known.
+//
+// Responses carry the IETF RateLimit and RateLimit-Policy headers alongside
+// the legacy X-RateLimit-* ones, and 429s carry Retry-After.
 func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
-		key := clientKey(r, m.apiKey)
-		lv, err := m.limiter.Get(ctx, key)
-		if err != nil {
-			http.Error(w, "rate limit error", http.StatusInternalServerError)
+		ctx := context.WithoutCancel(r.Context())
+		plan, lim := m.limiterFor(r)
+		if lim == nil {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", lv.Limit))
-		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", lv.Remaining))
-		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", lv.Reset))
+		key := plan + ":" + clientKey(r)
+		cost := m.routeCost(r)
+		lv, err := lim.Increment(ctx, key, cost)
+		if err == nil {
+			outcome := "allowed"
+			if lv.Reached {
+				outcome = "throttled"
+			}
+			m.countDecision(ctx, r, plan, outcome)
+		} else {
+			m.countDecision(ctx, r, plan, "error")
+			zerolog.Ctx(r.Context()).Warn().Err(err).Str("failure_mode", m.failureMode).Msg("rate limit store unavailable")
+			if m.failureMode == FailClosed {
+				m.countFallback(ctx, plan, "rejected")
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, problem.Problem{
+					Type:     "https://aka-project/problems/rate-limit-unavailable",
+					Title:    "Rate limiting unavailable",
+					Status:   http.StatusServiceUnavailable,
+					Detail:   "rate limits cannot be checked right now",
+					Instance: r.URL.Path,
+				})
+				return
+			}
+			lv, err = m.fallback[lim].Increment(ctx, key, cost)
+			if err != nil {
+				// The in-memory store does not fail; let the request through
+				// rather than take the API down if it ever does.
+				m.countFallback(ctx, plan, "allowed")
+				next.ServeHTTP(w, r)
+				return
+			}
+			if lv.Reached {
+				m.countFallback(ctx, plan, "throttled")
+			} else {
+				m.countFallback(ctx, plan, "allowed")
+			}
+		}
+
+		setRateLimitHeaders(w, plan, lim.Rate, lv)
 
 		if lv.Reached {
-			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			w.Header().Set("Retry-After", strconv.FormatInt(secondsUntil(lv.Reset), 10))
+			problem.Write(w, problem.Problem{
+				Type:     "https://aka-project/problems/rate-limited",
+				Title:    "Too many requests",
+				Status:   http.StatusTooManyRequests,
+				Detail:   "rate limit exceeded",
+				Instance: r.URL.Path,
+				Extensions: map[string]any{
+					"plan": plan,
+				},
+			})
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// countDecision records what the Redis limiter decided; requests it could
+// not decide count as "error", and the fallback's verdict is counted by
+// countFallback.
+func (m *Middleware) countDecision(ctx context.Context, r *http.Request, plan, outcome string) {
+	m.decisions.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("plan", plan),
+		attribute.String("http.route", routePattern(r)),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (m *Middleware) countFallback(ctx context.Context, plan, decision string) {
+	m.fallbackCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("mode", m.failureMode),
+		attribute.String("plan", plan),
+		attribute.String("decision", decision),
+	))
+}
+
+// setRateLimitHeaders writes the RateLimit-Policy and RateLimit fields from
+// draft-ietf-httpapi-ratelimit-headers, plus the X-RateLimit-* headers
+// existing clients read.
+func setRateLimitHeaders(w http.ResponseWriter, plan string, rate limiter.Rate, lv limiter.Context) {
+	reset := secondsUntil(lv.Reset)
+	window := int64(rate.Period / time.Second)
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%q;q=%d;w=%d", plan, rate.Limit, window))
+	w.Header().Set("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", plan, lv.Remaining, reset))
+
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", lv.Limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", lv.Remaining))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", lv.Reset))
+}
+
+// secondsUntil converts a unix reset time into delta seconds, never less
+// than one so clients do not retry immediately.
+func secondsUntil(reset int64) int64 {
+	return max(reset-time.Now().Unix(), 1)
+}
+
+// limiterFor returns the plan applied to the request and its limiter, which
+// is nil for unlimited plans.
+func (m *Middleware) limiterFor(r *http.Request) (string, *limiter.Limiter) {
+	plan := m.defaultPlan
+	if id, ok := auth.IdentityFromContext(r.Context()); ok && id.Plan != "" {
+		plan = id.Plan
+	}
+	if lim, ok := m.plans[plan]; ok {
+		return plan, lim
+	}
+	if plan == "" {
+		plan = "default"
+	}
+	return plan, m.limiter
+}
+
+func (m *Middleware) routeCost(r *http.Request) int64 {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if cost, ok := m.routeCosts[rctx.RoutePattern()]; ok {
+			return cost
+		}
+	}
+	return 1
+}
+
 // API key middleware
 func (m *Middleware) RequireAPIKey(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("X-API-Key")
-		if auth != m.apiKey {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
+	return RequireAuth(m.APIKeyAuth())(next)
+}
+
+// APIKeyAuth authenticates the X-API-Key header against the key store.
+func (m *Middleware) APIKeyAuth() Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*auth.Identity, error) {
+		ctx := r.Context()
+		raw := r.Header.Get("X-API-Key")
+		if raw == "" {
+			return nil, auth.ErrNoCredentials
 		}
-		next.ServeHTTP(w, r)
+
+		key, err := m.apiKeys.GetByKey(ctx, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if key.RevokedAt.Valid || (key.ExpiresAt.Valid && !now.Before(key.ExpiresAt.Time)) {
+			return nil, internal.NewError(internal.ErrorCodeUnauthorized, "api key expired or revoked").
+				WithFields(map[string]any{"entity": "api_key", "id": key.ID})
+		}
+		m.apiKeys.MarkUsed(ctx, key.ID)
+
+		return &auth.Identity{
+			Method: auth.MethodAPIKey,
+			KeyID:  key.ID,
+			Prefix: key.Prefix,
+			Owner:  key.Owner,
+			Label:  key.Label,
+			Scopes: key.Scopes,
+			Plan:   key.Plan,
+			UserID: key.UserID.Int64,
+			Tenant: key.Tenant,
+		}, nil
 	})
 }
 
-func clientKey(r *http.Request, apiKey string) string {
-	key := r.Header.Get("X-API-Key")
-	if key != "" {
-		return "apikey:" + key
-	}
-	ip := r.Header.Get("X-Real-IP")
-	if ip == "" {
-		ip = r.RemoteAddr
-		if idx := strings.LastIndex(ip, ":"); idx != -1 {
-			ip = ip[:idx]
-		}
+// clientKey identifies the caller for rate limits and idempotency. Callers
+// are namespaced by tenant so tenants never share a bucket or a replay.
+func clientKey(r *http.Request) string {
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		return id.Tenant + ":" + id.Key()
 	}
-	return "ip:" + ip
+	return "ip:" + ClientIP(r)
 }
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIPResolver determines the address of the client behind any trusted
+// reverse proxies. Forwarding headers are only believed when the connection
+// comes from a trusted proxy, so clients cannot spoof their address.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver trusts the given CIDRs or single addresses. With no
+// trusted proxies the connection's peer address is always used.
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	c := &ClientIPResolver{}
+	for _, s := range trustedProxies {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+			}
+			addr = addr.Unmap()
+			c.trusted = append(c.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		c.trusted = append(c.trusted, prefix.Masked())
+	}
+	return c, nil
+}
+
+// Resolve returns the client address for r. X-Forwarded-For is walked from
+// the right, skipping trusted proxies, and the first untrusted hop wins;
+// X-Real-IP is used when a trusted proxy sent no X-Forwarded-For.
+func (c *ClientIPResolver) Resolve(r *http.Request) netip.Addr {
+	addr, ok := peerAddr(r.RemoteAddr)
+	if !ok || !c.isTrusted(addr) {
+		return addr
+	}
+
+	hops := forwardedFor(r.Header)
+	if len(hops) == 0 {
+		if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return ip.Unmap()
+		}
+		return addr
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// A malformed entry was not written by a proxy we trust, so
+			// nothing to its left can be believed either.
+			return addr
+		}
+		addr = hop.Unmap()
+		if !c.isTrusted(addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// Middleware resolves the client address once per request and stores it
+// for ClientIP.
+func (c *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr := c.Resolve(r); addr.IsValid() {
+			r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, addr))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the address resolved by ClientIPResolver.Middleware, or
+// the connection's peer address when the resolver did not run.
+func ClientIP(r *http.Request) string {
+	if addr, ok := r.Context().Value(clientIPKey{}).(netip.Addr); ok {
+		return addr.String()
+	}
+	if addr, ok := peerAddr(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddr parses "host:port", "[v6]:port" or a bare address, dropping any
+// IPv6 zone and unmapping IPv4-mapped addresses.
+func peerAddr(remote string) (netip.Addr, bool) {
+	host := remote
+	if h, _, err := net.SplitHostPort(remote); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// forwardedFor flattens every X-Forwarded-For header into one hop list.
+// Entries may carry a port, and IPv6 entries may be bracketed.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			hop = strings.TrimSpace(hop)
+			if host, _, err := net.SplitHostPort(hop); err == nil {
+				hop = host
+			}
+			hops = append(hops, strings.Trim(hop, "[]"))
+		}
+	}
+	return hops
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"aka-project/internal/auth"
+	"aka-project/internal/logger"
+
+	"github.com/rs/zerolog"
+)
+
+// HeaderDebugLog carries a token minted by DebugLogToken.
+const HeaderDebugLog = "X-Debug-Log"
+
+// maxDebugLogTTL bounds how far in the future a debug token may expire, so
+// a leaked token is short-lived.
+const maxDebugLogTTL = time.Hour
+
+// DebugLogToken returns an X-Debug-Log value valid until expiry.
+func DebugLogToken(secret string, expiry time.Time) string {
+	exp := strconv.FormatInt(expiry.Unix(), 10)
+	return exp + "." + auth.Sign(secret, "debug-log\n"+exp)
+}
+
+// DebugLog enables debug logging for a single request carrying a valid
+// X-Debug-Log token, whatever the default level, by handing the rest of the
+// chain a debug-level copy of the request logger. It is honoured only for
+// identities with the admin scope, so it must run after RequireAuth and
+// the Logger middleware. Invalid tokens are ignored, never rejected.
+func DebugLog(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(HeaderDebugLog)
+			if secret == "" || token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			l := zerolog.Ctx(r.Context())
+			id, ok := auth.IdentityFromContext(r.Context())
+			switch {
+			case !ok || !id.HasScope(auth.ScopeAdmin):
+				l.Warn().Msg("debug log header ignored: caller is not an admin")
+			case !validDebugLogToken(secret, token, time.Now()):
+				l.Warn().Msg("debug log header ignored: invalid or expired token")
+			default:
+				debug := logger.Debug(*l)
+				r = r.WithContext(debug.WithContext(r.Context()))
+				l.Info().Msg("debug logging enabled for request")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func validDebugLogToken(secret, token string, now time.Time) bool {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiry := time.Unix(unix, 0)
+	if !expiry.After(now) || expiry.Sub(now) > maxDebugLogTTL {
+		return false
+	}
+	return auth.SignatureMatches(auth.Sign(secret, "debug-log\n"+exp), sig)
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxSignedBodyBytes bounds how much of a signed request body is buffered
+// to verify its hash.
+const maxSignedBodyBytes = 10 << 20
+
+// HMACAuth authenticates requests signed with a shared secret. Signatures
+// outside the clock-skew window are rejected and nonces are remembered in
+// Redis for twice that window so a captured request cannot be replayed.
+type HMACAuth struct {
+	clients map[string]auth.HMACClient
+	nonces  *redis.Client
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+func NewHMACAuth(clients []auth.HMACClient, redisClient *redis.Client, maxSkew time.Duration) *HMACAuth {
+	byID := make(map[string]auth.HMACClient, len(clients))
+	for _, c := range clients {
+		byID[c.KeyID] = c
+	}
+	return &HMACAuth{
+		clients: byID,
+		nonces:  redisClient,
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+func (h *HMACAuth) Authenticate(r *http.Request) (*auth.Identity, error) {
+	signature := r.Header.Get(auth.HeaderSignature)
+	if signature == "" {
+		return nil, auth.ErrNoCredentials
+	}
+	keyID := r.Header.Get(auth.HeaderSignatureKeyID)
+	timestamp := r.Header.Get(auth.HeaderSignatureTimestamp)
+	nonce := r.Header.Get(auth.HeaderSignatureNonce)
+	if keyID == "" || timestamp == "" || nonce == "" {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "incomplete signature headers")
+	}
+
+	client, ok := h.clients[keyID]
+	if !ok {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "unknown signing key").
+			WithField("key_id", keyID)
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "invalid signature timestamp")
+	}
+	if skew := h.now().Sub(time.Unix(ts, 0)).Abs(); skew > h.maxSkew {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "signature timestamp outside allowed skew").
+			WithFields(map[string]any{"key_id": keyID, "skew": skew.String()})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodyBytes+1))
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInvalidArgument, "failed to read request body"))
+	}
+	if len(body) > maxSignedBodyBytes {
+		return nil, internal.NewError(internal.ErrorCodeInvalidArgument, "signed body too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	canonical := auth.CanonicalRequest(r.Method, r.URL.Path, r.URL.Query(), body, timestamp, nonce)
+	if !auth.SignatureMatches(auth.Sign(client.Secret, canonical), signature) {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "signature mismatch").
+			WithField("key_id", keyID)
+	}
+
+	// Only valid signatures reach the nonce store, so garbage cannot fill it.
+	fresh, err := h.nonces.SetNX(r.Context(), "hmac_nonce:"+keyID+":"+nonce, 1, 2*h.maxSkew).Result()
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeUnavailable, "failed to record signature nonce"))
+	}
+	if !fresh {
+		return nil, internal.NewError(internal.ErrorCodeUnauthorized, "signature nonce already used").
+			WithField("key_id", keyID)
+	}
+
+	return &auth.Identity{
+		Method:  auth.MethodHMAC,
+		Subject: keyID,
+		Owner:   client.Owner,
+		Label:   keyID,
+		Scopes:  client.Scopes,
+		Plan:    client.Plan,
+		Tenant:  client.Tenant,
+	}, nil
+}
@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"aka-project/internal/auth"
+	"aka-project/internal/problem"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// HeaderIdempotencyKey carries the client-chosen key of a retryable
+	// mutating request.
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks responses served from the store.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 10 << 20
+	// idempotencyInFlightGrace is the lifetime of the in-flight marker. It
+	// exceeds the server WriteTimeout with margin and is extended while
+	// the handler runs, so it only lapses if the replica dies.
+	idempotencyInFlightGrace = time.Minute
+)
+
+// The in-flight marker embeds a random token, so these scripts only touch
+// the marker the calling request wrote.
+var (
+	// idempotencyComplete replaces the marker with the response.
+	idempotencyComplete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+end
+return false`)
+	// idempotencyExtend keeps the marker alive.
+	idempotencyExtend = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	// idempotencyRelease frees the key for a retry.
+	idempotencyRelease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// idempotencyRecord is what the store holds for a key: the request
+// fingerprint and, once the handler has finished, its response.
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Token       string      `json:"token,omitempty"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Idempotency makes POST, PUT, PATCH and DELETE requests carrying an
+// Idempotency-Key safe to retry. The first request runs and its response is
+// stored in Redis for ttl, scoped to the caller; retries with the same key
+// get the stored response replayed. Reusing a key for a different request,
+// or while the first is still running, yields 409. Server errors are not
+// stored so the request can be retried for real.
+//
+// It must run after authentication so keys are scoped to the credential:
+// the identity, or for /admin routes the admin key.
+func Idempotency(rdb *redis.Client, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderIdempotencyKey)
+			if key == "" || !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeIdempotencyProblem(w, r, http.StatusBadRequest, "invalid-idempotency-key", "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodyBytes+1))
+			if err != nil || len(body) > maxIdempotentBodyBytes {
+				writeIdempotencyProblem(w, r, http.StatusRequestEntityTooLarge, "request-too-large", "request body is too large to fingerprint")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := context.WithoutCancel(r.Context())
+			storeKey := "idempotency:" + idempotencyScope(r) + ":" + key
+			fingerprint := requestFingerprint(r, body)
+			logger := zerolog.Ctx(r.Context())
+
+			token := make([]byte, 16)
+			_, _ = rand.Read(token)
+			pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint, Token: hex.EncodeToString(token)})
+			fresh, err := rdb.SetNX(ctx, storeKey, pending, idempotencyInFlightGrace).Result()
+			if err != nil {
+				logger.Error().Err(err).Msg("idempotency store unavailable")
+				writeIdempotencyProblem(w, r, http.StatusServiceUnavailable, "idempotency-unavailable", "idempotency keys cannot be checked right now")
+				return
+			}
+			if !fresh {
+				replayIdempotent(w, r, rdb, storeKey, fingerprint)
+				return
+			}
+			release := func() {
+				if err := idempotencyRelease.Run(ctx, rdb, []string{storeKey}, pending).Err(); err != nil {
+					logger.Warn().Err(err).Msg("failed to release idempotency key")
+				}
+			}
+			stopExtending := extendIdempotencyMarker(ctx, rdb, storeKey, pending)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			var buf bytes.Buffer
+			ww.Tee(&buf)
+			before := w.Header().Clone()
+
+			completed := false
+			defer func() {
+				stopExtending()
+				if !completed {
+					// The handler panicked; release the key for a retry.
+					release()
+				}
+			}()
+			next.ServeHTTP(ww, r)
+			completed = true
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				release()
+				return
+			}
+			done, err := json.Marshal(idempotencyRecord{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      status,
+				Header:      addedHeaders(before, w.Header()),
+				Body:        buf.Bytes(),
+			})
+			if err == nil {
+				err = idempotencyComplete.Run(ctx, rdb, []string{storeKey}, pending, done, ttl.Milliseconds()).Err()
+			}
+			if errors.Is(err, redis.Nil) {
+				// The marker was lost, so a retry may have run as well; its
+				// outcome is kept rather than overwritten.
+				logger.Warn().Msg("idempotency marker lost before the response was stored")
+				return
+			}
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to store idempotent response")
+				release()
+			}
+		})
+	}
+}
+
+// extendIdempotencyMarker keeps the in-flight marker alive until the
+// returned stop function is called.
+func extendIdempotencyMarker(ctx context.Context, rdb *redis.Client, storeKey string, pending []byte) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(idempotencyInFlightGrace / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				idempotencyExtend.Run(ctx, rdb, []string{storeKey}, pending, idempotencyInFlightGrace.Milliseconds())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// idempotencyScope is the credential keys are scoped to. /admin routes
+// carry no identity, so they are scoped to a hash of the admin key.
+func idempotencyScope(r *http.Request) string {
+	if _, ok := auth.IdentityFromContext(r.Context()); !ok {
+		if adminKey := r.Header.Get("X-Admin-Key"); adminKey != "" {
+			sum := sha256.Sum256([]byte(adminKey))
+			return "admin:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return clientKey(r)
+}
+
+func replayIdempotent(w http.ResponseWriter, r *http.Request, rdb *redis.Client, storeKey, fingerprint string) {
+	raw, err := rdb.Get(r.Context(), storeKey).Bytes()
+	var rec idempotencyRecord
+	if err == nil {
+		err = json.Unmarshal(raw, &rec)
+	}
+	switch {
+	case errors.Is(err, redis.Nil):
+		// The first request failed and released the key just now.
+		w.Header().Set("Retry-After", "1")
+		writeIdempotencyProblem(w, r, http.StatusConflict, "idempotency-key-in-use", "a request with this Idempotency-Key is in progress")
+	case err != nil:
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("idempotency store unavailable")
+		writeIdempotencyProblem(w, r, http.StatusServiceUnavailable, "idempotency-unavailable", "idempotency keys cannot be checked right now")
+	case rec.Fingerprint != fingerprint:
+		writeIdempotencyProblem(w, r, http.StatusConflict, "idempotency-key-reused", "this Idempotency-Key was used for a different request")
+	case !rec.Done:
+		w.Header().Set("Retry-After", "1")
+		writeIdempotencyProblem(w, r, http.StatusConflict, "idempotency-key-in-use", "a request with this Idempotency-Key is in progress")
+	default:
+		for name, values := range rec.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(HeaderIdempotentReplayed, "true")
+		w.WriteHeader(rec.Status)
+		_, _ = w.Write(rec.Body)
+	}
+}
+
+func writeIdempotencyProblem(w http.ResponseWriter, r *http.Request, status int, kind, detail string) {
+	problem.Write(w, problem.Problem{
+		Type:     "https://aka-project/problems/" + kind,
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+// requestFingerprint hashes what makes two requests "the same": method,
+// path, query and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n"+r.URL.Path+"\n"+r.URL.Query().Encode()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// addedHeaders returns the headers the handler set, leaving out those set by
+// earlier middleware (rate limits, quotas) which are recomputed on replay.
+func addedHeaders(before, after http.Header) http.Header {
+	out := http.Header{}
+	for name, values := range after {
+		if _, ok := before[name]; !ok {
+			out[name] = values
+		}
+	}
+	return out
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
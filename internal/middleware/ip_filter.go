@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+
+	"aka-project/internal/ipfilter"
+	"aka-project/internal/problem"
+
+	"github.com/rs/zerolog"
+)
+
+// IPFilter rejects requests whose client address the filter's rules do not
+// admit to group. It relies on ClientIPResolver.Middleware having run, and
+// should come before authentication so blocked networks cost no lookups.
+func IPFilter(f *ipfilter.Filter, group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// An unparseable address matches no rule, so it passes deny
+			// lists but not allow lists.
+			addr, _ := netip.ParseAddr(ClientIP(r))
+			d := f.Check(r.Context(), group, addr)
+			if !d.Allowed {
+				event := zerolog.Ctx(r.Context()).Warn().Str("ip_group", group)
+				if d.Matched {
+					event = event.Stringer("ip_rule", d.Rule)
+				} else {
+					event = event.Str("ip_rule", "not in allow list")
+				}
+				event.Msg("request blocked by ip filter")
+
+				problem.Write(w, problem.Problem{
+					Type:     "https://aka-project/problems/ip-blocked",
+					Title:    "Forbidden",
+					Status:   http.StatusForbidden,
+					Detail:   "requests from this address are not allowed",
+					Instance: r.URL.Path,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
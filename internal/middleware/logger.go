@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func Logger(next http.Handler) http.Handler {
@@ -13,8 +15,21 @@ func Logger(next http.Handler) http.Handler {
 		start := time.Now()
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
+		lc := log.With().
+			Str("request_id", middleware.GetReqID(r.Context())).
+			Str("client_ip", ClientIP(r))
+		// Tracing runs first, so log lines can be joined with their trace.
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			lc = lc.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+		}
+		l := lc.Logger()
+		r = r.WithContext(l.WithContext(r.Context()))
+
+		// Downstream middleware may enrich the request logger (e.g. with the
+		// authenticated caller), so the access log uses it rather than the
+		// global logger.
 		defer func() {
-			log.Info().
+			zerolog.Ctx(r.Context()).Info().
 				Str("method", r.Method).
 				Str("path", r.URL.Path).
 				Int("status", ww.Status()).
@@ -22,11 +37,6 @@ func Logger(next http.Handler) http.Handler {
 				Msg("request handled")
 		}()
 
-		log := log.With().
-			Str("request_id", middleware.GetReqID(r.Context())).
-			Logger()
-		r = r.WithContext(log.WithContext(r.Context()))
-
 		next.ServeHTTP(ww, r)
 	})
 }
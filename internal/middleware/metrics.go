@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"aka-project/internal/telemetry"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners probing
+// random paths cannot blow up the label cardinality.
+const unmatchedRoute = "unmatched"
+
+// HTTPMetrics records rate, errors and duration for every request, labelled
+// by chi route pattern, method and status class.
+type HTTPMetrics struct {
+	requests     metric.Int64Counter
+	duration     metric.Float64Histogram
+	inFlight     metric.Int64UpDownCounter
+	responseSize metric.Int64Histogram
+}
+
+func NewHTTPMetrics(meter metric.Meter) (*HTTPMetrics, error) {
+	requests, err := meter.Int64Counter(
+		"api.http.requests_total",
+		metric.WithDescription("Requests handled, by route, method and status class"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram(
+		"api.http.request_duration_seconds",
+		metric.WithDescription("Time to handle a request, by route, method and status class"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(telemetry.DurationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := meter.Int64UpDownCounter(
+		"api.http.requests_in_flight",
+		metric.WithDescription("Requests being handled, by method"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	responseSize, err := meter.Int64Histogram(
+		"api.http.response_size_bytes",
+		metric.WithDescription("Response body size, by route, method and status class"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(telemetry.SizeBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPMetrics{
+		requests:     requests,
+		duration:     duration,
+		inFlight:     inFlight,
+		responseSize: responseSize,
+	}, nil
+}
+
+// Middleware must wrap the router: the route pattern is only known once
+// chi has routed the request, so it is read after the handler returns. The
+// in-flight gauge is labelled by method alone for the same reason.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		method := attribute.String("http.method", r.Method)
+		m.inFlight.Add(ctx, 1, metric.WithAttributes(method))
+		defer m.inFlight.Add(ctx, -1, metric.WithAttributes(method))
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			// Nothing was written, which net/http answers with 200.
+			status = http.StatusOK
+		}
+		attrs := metric.WithAttributes(
+			attribute.String("http.route", routePattern(r)),
+			method,
+			attribute.String("http.status_class", strconv.Itoa(status/100)+"xx"),
+		)
+		m.requests.Add(ctx, 1, attrs)
+		m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+		m.responseSize.Record(ctx, int64(ww.BytesWritten()), attrs)
+	})
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return unmatchedRoute
+}
@@ -1,17 +1,132 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+
+	"aka-project/internal/db"
+	"aka-project/internal/repository"
+
 	"github.com/redis/go-redis/v9"
 	"github.com/ulule/limiter/v3"
+	memorystore "github.com/ulule/limiter/v3/drivers/store/memory"
 	redisstore "github.com/ulule/limiter/v3/drivers/store/redis"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// PlanUnlimited disables rate limiting for a plan.
+const PlanUnlimited = "unlimited"
+
+// Failure modes decide what RateLimit does when Redis is unreachable.
+const (
+	// FailOpen keeps limiting with a per-replica in-memory limiter, so
+	// the effective limit is multiplied by the number of replicas.
+	FailOpen = "open"
+	// FailClosed rejects requests with 503 until Redis is back.
+	FailClosed = "closed"
 )
 
+// APIKeyStore resolves raw API keys to their stored records.
+type APIKeyStore interface {
+	GetByKey(ctx context.Context, raw string) (db.ApiKey, error)
+	MarkUsed(ctx context.Context, id int64)
+}
+
 type Middleware struct {
+	store   limiter.Store
 	limiter *limiter.Limiter
-	apiKey  string
+	// plans maps a plan name to its limiter; a nil limiter means unlimited.
+	plans       map[string]*limiter.Limiter
+	defaultPlan string
+	routeCosts  map[string]int64
+	apiKeys     APIKeyStore
+	// quotas maps a plan name to its long-window quota; plans without an
+	// entry are not metered against a quota.
+	quotas map[string]repository.Quota
+	usage  UsageTracker
+
+	failureMode string
+	// fallback holds an in-memory twin of every Redis-backed limiter.
+	fallback        map[*limiter.Limiter]*limiter.Limiter
+	meter           metric.Meter
+	fallbackCounter metric.Int64Counter
+	decisions       metric.Int64Counter
+}
+
+// Option customizes a Middleware.
+type Option func(*Middleware) error
+
+// WithPlans configures per-plan rates. Values are limiter formatted rates
+// such as "60-M", or PlanUnlimited. Callers without a plan use defaultPlan;
+// unknown plans fall back to the base rate.
+func WithPlans(plans map[string]string, defaultPlan string) Option {
+	return func(m *Middleware) error {
+		for name, spec := range plans {
+			if spec == PlanUnlimited {
+				m.plans[name] = nil
+				continue
+			}
+			rate, err := limiter.NewRateFromFormatted(spec)
+			if err != nil {
+				return fmt.Errorf("plan %q: %w", name, err)
+			}
+			m.plans[name] = limiter.New(m.store, rate)
+		}
+		m.defaultPlan = defaultPlan
+		return nil
+	}
+}
+
+// WithRouteCosts makes requests to the given chi route patterns consume
+// more than one request from the caller's allowance.
+func WithRouteCosts(costs map[string]int64) Option {
+	return func(m *Middleware) error {
+		for pattern, cost := range costs {
+			if cost < 1 {
+				return fmt.Errorf("route %q: cost must be at least 1", pattern)
+			}
+			m.routeCosts[pattern] = cost
+		}
+		return nil
+	}
+}
+
+// WithQuotas enables EnforceQuota with per-plan daily and monthly quotas,
+// counted by tracker.
+func WithQuotas(tracker UsageTracker, quotas map[string]repository.Quota) Option {
+	return func(m *Middleware) error {
+		for name, q := range quotas {
+			if q.Daily < 0 || q.Monthly < 0 {
+				return fmt.Errorf("plan %q: quota must not be negative", name)
+			}
+			m.quotas[name] = q
+		}
+		m.usage = tracker
+		return nil
+	}
 }
 
-func NewMiddleware(redisClient *redis.Client, rateSpec string, apiKey string) (*Middleware, error) {
+// WithFailureMode selects FailOpen or FailClosed.
+func WithFailureMode(mode string) Option {
+	return func(m *Middleware) error {
+		if mode != FailOpen && mode != FailClosed {
+			return fmt.Errorf("unknown rate limit failure mode %q", mode)
+		}
+		m.failureMode = mode
+		return nil
+	}
+}
+
+// WithMeter records rate limiter metrics on meter.
+func WithMeter(meter metric.Meter) Option {
+	return func(m *Middleware) error {
+		m.meter = meter
+		return nil
+	}
+}
+
+func NewMiddleware(redisClient *redis.Client, rateSpec string, apiKeys APIKeyStore, opts ...Option) (*Middleware, error) {
 	rate, err := limiter.NewRateFromFormatted(rateSpec)
 	if err != nil {
 		return nil, err
@@ -22,8 +137,42 @@ func NewMiddleware(redisClient *redis.Client, rateSpec string, apiKey string) (*
 	if err != nil {
 		return nil, err
 	}
-	return &Middleware{
-		limiter: limiter.New(store, rate),
-		apiKey:  apiKey,
-	}, nil
+	m := &Middleware{
+		store:       store,
+		limiter:     limiter.New(store, rate),
+		plans:       map[string]*limiter.Limiter{},
+		routeCosts:  map[string]int64{},
+		quotas:      map[string]repository.Quota{},
+		apiKeys:     apiKeys,
+		failureMode: FailOpen,
+		meter:       noop.NewMeterProvider().Meter("aka-project"),
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+
+	m.fallbackCounter, err = m.meter.Int64Counter(
+		"rate_limit.fallback_decisions_total",
+		metric.WithDescription("Rate limit decisions made without Redis, by failure mode and outcome"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.decisions, err = m.meter.Int64Counter(
+		"rate_limit.decisions_total",
+		metric.WithDescription("Rate limit outcomes (allowed, throttled, error) by plan and route"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	local := memorystore.NewStore()
+	m.fallback = map[*limiter.Limiter]*limiter.Limiter{m.limiter: limiter.New(local, rate)}
+	for _, lim := range m.plans {
+		if lim != nil {
+			m.fallback[lim] = limiter.New(local, lim.Rate)
+		}
+	}
+	return m, nil
 }
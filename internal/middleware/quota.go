@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aka-project/internal/auth"
+	"aka-project/internal/problem"
+	"aka-project/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+// UsageTracker counts calls against long-window quotas.
+type UsageTracker interface {
+	Consume(ctx context.Context, subject string, cost int64, now time.Time) (repository.QuotaUsage, error)
+	Refund(ctx context.Context, subject string, cost int64, now time.Time)
+	Record(ctx context.Context, subject, endpoint string, now time.Time)
+}
+
+// EnforceQuota meters authenticated callers against their plan's daily and
+// monthly quotas and records accepted calls for usage reporting. Like
+// RateLimit it must run after authentication and inside the router. When the
+// quota store is unavailable requests are let through rather than failing.
+func (m *Middleware) EnforceQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := auth.IdentityFromContext(r.Context())
+		if !ok || m.usage == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		plan, _ := m.limiterFor(r)
+		subject := id.Key()
+		ctx := context.WithoutCancel(r.Context())
+		now := time.Now()
+
+		if quota, ok := m.quotas[plan]; ok && (quota.Daily > 0 || quota.Monthly > 0) {
+			cost := m.routeCost(r)
+			used, err := m.usage.Consume(ctx, subject, cost, now)
+			if err != nil {
+				zerolog.Ctx(r.Context()).Warn().Err(err).Msg("quota check failed, allowing request")
+			} else {
+				setQuotaHeaders(w, quota, used)
+				if period, reset := exhausted(quota, used, now); period != "" {
+					m.usage.Refund(ctx, subject, cost, now)
+					writeQuotaExceeded(w, r, period, reset, now)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+
+		endpoint := r.Method + " " + r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			endpoint = r.Method + " " + rctx.RoutePattern()
+		}
+		m.usage.Record(ctx, subject, endpoint, now)
+	})
+}
+
+func setQuotaHeaders(w http.ResponseWriter, quota repository.Quota, used repository.QuotaUsage) {
+	if quota.Daily > 0 {
+		w.Header().Set("X-Quota-Limit-Day", strconv.FormatInt(quota.Daily, 10))
+		w.Header().Set("X-Quota-Remaining-Day", strconv.FormatInt(max(quota.Daily-used.Day, 0), 10))
+	}
+	if quota.Monthly > 0 {
+		w.Header().Set("X-Quota-Limit-Month", strconv.FormatInt(quota.Monthly, 10))
+		w.Header().Set("X-Quota-Remaining-Month", strconv.FormatInt(max(quota.Monthly-used.Month, 0), 10))
+	}
+}
+
+// exhausted returns the period whose quota was exceeded, preferring the one
+// that resets last, and when it resets.
+func exhausted(quota repository.Quota, used repository.QuotaUsage, now time.Time) (string, time.Time) {
+	now = now.UTC()
+	if quota.Monthly > 0 && used.Month > quota.Monthly {
+		return "month", time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if quota.Daily > 0 && used.Day > quota.Daily {
+		return "day", time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+	return "", time.Time{}
+}
+
+func writeQuotaExceeded(w http.ResponseWriter, r *http.Request, period string, reset, now time.Time) {
+	zerolog.Ctx(r.Context()).Warn().Str("quota_period", period).Msg("quota exceeded")
+
+	window := "daily"
+	if period == "month" {
+		window = "monthly"
+	}
+
+	w.Header().Set("X-Quota-Period", period)
+	w.Header().Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(reset.Sub(now).Seconds())+1, 10))
+	problem.Write(w, problem.Problem{
+		Type:     "https://aka-project/problems/quota-exceeded",
+		Title:    "Quota exceeded",
+		Status:   http.StatusTooManyRequests,
+		Detail:   fmt.Sprintf("the %s quota for this credential is exhausted", window),
+		Instance: r.URL.Path,
+		Extensions: map[string]any{
+			"quota_period": period,
+			"quota_reset":  reset.Format(time.RFC3339),
+		},
+	})
+}
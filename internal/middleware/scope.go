@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"aka-project/internal/auth"
+	"aka-project/internal/problem"
+
+	"github.com/rs/zerolog"
+)
+
+// RequireScope rejects requests whose authenticated identity lacks any of
+// the given scopes. It must run after an authentication middleware.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := auth.IdentityFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			missing := id.MissingScopes(scopes...)
+			if len(missing) > 0 {
+				zerolog.Ctx(r.Context()).Warn().
+					Strs("missing_scopes", missing).
+					Msg("insufficient scope")
+				problem.Write(w, problem.Problem{
+					Type:     "https://aka-project/problems/insufficient-scope",
+					Title:    "Insufficient scope",
+					Status:   http.StatusForbidden,
+					Detail:   "this credential is missing the scope(s): " + strings.Join(missing, ", "),
+					Instance: r.URL.Path,
+					Extensions: map[string]any{
+						"required_scopes": scopes,
+						"missing_scopes":  missing,
+					},
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// untracedPaths are polled by the kubelet every few seconds; tracing them
+// would only crowd out real traffic.
+var untracedPaths = map[string]bool{
+	"/livez":       true,
+	"/readyz":      true,
+	"/startupz":    true,
+	"/healthcheck": true,
+}
+
+// Tracing starts a server span for every request, continuing the caller's
+// trace when it sends W3C traceparent headers. Like HTTPMetrics it must wrap
+// the router, so the span can be named after the matched route pattern.
+func Tracing(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		route := routePattern(r)
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+	})
+	return otelhttp.NewHandler(named, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool { return !untracedPaths[r.URL.Path] }),
+		// HTTPMetrics already records request metrics with route labels.
+		otelhttp.WithMeterProvider(noop.NewMeterProvider()),
+	)
+}
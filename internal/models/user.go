@@ -5,4 +5,5 @@ type User struct {
 	Name      string `db:"name" json:"name"`
 	Email     string `db:"email" json:"email"`
 	CreatedAt string `db:"created_at" json:"created_at"`
+	Tenant    string `db:"tenant" json:"tenant"`
 }
@@ -0,0 +1,472 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
+	"aka-project/internal/tenant"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	apiKeyCachePrefix = "api_keys:"
+	// apiKeyInvalidationChannel carries hashes of keys whose cached state is
+	// stale, so every replica can drop them from memory.
+	apiKeyInvalidationChannel = "api_keys:invalidate"
+	// maxCachedAPIKeys bounds the keys held in memory.
+	maxCachedAPIKeys = 10000
+	// maxCachedMissingAPIKeys bounds the cached misses separately, so a flood
+	// of random keys churns them without evicting keys that exist.
+	maxCachedMissingAPIKeys = 1000
+	// lastUsedResolution is how often last_used_at is written for a key.
+	lastUsedResolution = time.Minute
+)
+
+type cachedAPIKey struct {
+	key     db.ApiKey
+	expires time.Time
+}
+
+// APIKeyRepo looks up hashed API keys in Postgres behind a short-lived
+// in-memory cache, shared across replicas through Redis when available.
+type APIKeyRepo struct {
+	Queries db.Querier
+	Redis   *redis.Client
+	TTL     time.Duration
+
+	mu      sync.Mutex
+	cache   map[string]cachedAPIKey
+	misses  map[string]cachedAPIKey
+	touched map[int64]time.Time
+}
+
+func NewAPIKeyRepo(queries db.Querier, redisClient *redis.Client, ttl time.Duration) *APIKeyRepo {
+	return &APIKeyRepo{
+		Queries: queries,
+		Redis:   redisClient,
+		TTL:     ttl,
+		cache:   map[string]cachedAPIKey{},
+		misses:  map[string]cachedAPIKey{},
+		touched: map[int64]time.Time{},
+	}
+}
+
+// NewAPIKey describes an API key to issue.
+type NewAPIKey struct {
+	Owner     string
+	Label     string
+	Scopes    []string
+	Plan      string
+	ExpiresAt *time.Time
+	// UserID links the key to a user; nil leaves it unlinked.
+	UserID *int64
+	// Tenant is the tenant the key acts for; empty means tenant.Default.
+	// A linked user must belong to it.
+	Tenant string
+}
+
+// GetByKey returns the stored key matching raw. Unknown keys yield an
+// unauthorized error; expiry and revocation are left to the caller.
+func (repo *APIKeyRepo) GetByKey(ctx context.Context, raw string) (db.ApiKey, error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.GetByKey")
+	defer span.End()
+	hash := auth.HashKey(raw)
+
+	key, found, ok := repo.fromMemory(hash)
+	if !ok {
+		key, found, ok = repo.fromRedis(ctx, hash)
+	}
+	if !ok {
+		k, err := repo.Queries.GetAPIKeyByHash(ctx, hash)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			key, found = db.ApiKey{}, false
+		case err != nil:
+			return db.ApiKey{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get api key"))
+		default:
+			key, found = k, true
+		}
+		repo.store(ctx, hash, key, found)
+	}
+
+	if !found || !auth.HashMatches(key.KeyHash, raw) {
+		return db.ApiKey{}, internal.NewError(internal.ErrorCodeUnauthorized, "invalid api key")
+	}
+	return key, nil
+}
+
+// EnsureKey stores raw if it is not already known, resets its scopes and
+// plan and returns its record. Unknown scopes are rejected, since a key
+// holding one would fail every scope check.
+func (repo *APIKeyRepo) EnsureKey(ctx context.Context, raw, owner, label string, scopes []string, plan string) (db.ApiKey, error) {
+	for _, s := range scopes {
+		if !auth.ValidScope(s) {
+			return db.ApiKey{}, internal.NewError(internal.ErrorCodeInvalidArgument, "unknown scope").
+				WithFields(map[string]any{"owner": owner, "scope": s})
+		}
+	}
+	key, err := repo.Queries.EnsureAPIKey(ctx, db.EnsureAPIKeyParams{
+		KeyHash: auth.HashKey(raw),
+		Prefix:  auth.KeyPrefix(raw),
+		Owner:   owner,
+		Label:   label,
+		Scopes:  scopes,
+		Plan:    plan,
+	})
+	if err != nil {
+		return db.ApiKey{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to ensure api key").
+			WithField("owner", owner))
+	}
+	return key, nil
+}
+
+// Create issues a new key and returns its record together with the raw
+// secret, which is not stored and cannot be recovered later.
+func (repo *APIKeyRepo) Create(ctx context.Context, k NewAPIKey) (db.ApiKey, string, error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.Create")
+	defer span.End()
+	key, raw, err := createAPIKey(ctx, repo.Queries, k)
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+	// Another replica may have cached a miss for this hash.
+	repo.Invalidate(ctx, key.KeyHash)
+	return key, raw, nil
+}
+
+func createAPIKey(ctx context.Context, q db.Querier, k NewAPIKey) (db.ApiKey, string, error) {
+	raw, err := auth.GenerateKey()
+	if err != nil {
+		return db.ApiKey{}, "", internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to generate api key"))
+	}
+
+	var expiresAt pgtype.Timestamptz
+	if k.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamptz{Time: *k.ExpiresAt, Valid: true}
+	}
+	if k.Tenant == "" {
+		k.Tenant = tenant.Default
+	}
+	var userID pgtype.Int8
+	if k.UserID != nil {
+		_, err := q.GetUser(ctx, db.GetUserParams{ID: *k.UserID, Tenant: k.Tenant})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.ApiKey{}, "", unknownUser(*k.UserID)
+		}
+		if err != nil {
+			return db.ApiKey{}, "", userLookupError(err, *k.UserID)
+		}
+		userID = pgtype.Int8{Int64: *k.UserID, Valid: true}
+	}
+	key, err := q.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		KeyHash:   auth.HashKey(raw),
+		Prefix:    auth.KeyPrefix(raw),
+		Owner:     k.Owner,
+		Label:     k.Label,
+		ExpiresAt: expiresAt,
+		Scopes:    k.Scopes,
+		Plan:      k.Plan,
+		UserID:    userID,
+		Tenant:    k.Tenant,
+	})
+	if isForeignKeyViolation(err) {
+		return db.ApiKey{}, "", unknownUser(*k.UserID)
+	}
+	if err != nil {
+		return db.ApiKey{}, "", internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to create api key").
+			WithField("owner", k.Owner))
+	}
+	return key, raw, nil
+}
+
+// List returns every stored key, including expired and revoked ones.
+func (repo *APIKeyRepo) List(ctx context.Context) ([]db.ApiKey, error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.List")
+	defer span.End()
+	keys, err := repo.Queries.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list api keys"))
+	}
+	return keys, nil
+}
+
+// Rotate issues a replacement for key id and lets the old key keep working
+// for grace, so clients can switch over without downtime. A key can only
+// be rotated once, and never once it is expired or revoked. Collections
+// owned by an unlinked key move to its replacement.
+func (repo *APIKeyRepo) Rotate(ctx context.Context, id int64, grace time.Duration) (db.ApiKey, string, error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.Rotate")
+	defer span.End()
+	var (
+		old, key db.ApiKey
+		raw      string
+	)
+	err := inTx(ctx, repo.Queries, func(q db.Querier) error {
+		var err error
+		old, err = q.GetAPIKey(ctx, id)
+		if err != nil {
+			return apiKeyLookupError(err, id)
+		}
+		if err := rotatable(old, time.Now()); err != nil {
+			return err
+		}
+
+		var expiresAt *time.Time
+		if old.ExpiresAt.Valid {
+			expiresAt = &old.ExpiresAt.Time
+		}
+		var userID *int64
+		if old.UserID.Valid {
+			userID = &old.UserID.Int64
+		}
+		key, raw, err = createAPIKey(ctx, q, NewAPIKey{
+			Owner:     old.Owner,
+			Label:     old.Label,
+			Scopes:    old.Scopes,
+			Plan:      old.Plan,
+			ExpiresAt: expiresAt,
+			UserID:    userID,
+			Tenant:    old.Tenant,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Guarded by replaced_by IS NULL, so of two concurrent rotations
+		// only one commits a successor.
+		old, err = q.RotateOutAPIKey(ctx, db.RotateOutAPIKeyParams{
+			ExpiresAt:  time.Now().Add(grace),
+			ReplacedBy: pgtype.Int8{Int64: key.ID, Valid: true},
+			ID:         id,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apiKeyConflict(id, "api key was already rotated or revoked")
+		}
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to expire rotated api key").
+				WithFields(map[string]any{"entity": "api_key", "id": id}))
+		}
+
+		// Keys linked to a user act as the user, whose data stays put.
+		if old.UserID.Valid {
+			return nil
+		}
+		_, err = q.ReassignCollections(ctx, db.ReassignCollectionsParams{
+			NewOwner: auth.APIKeySubject(key.ID),
+			Tenant:   key.Tenant,
+			OldOwner: auth.APIKeySubject(old.ID),
+		})
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to move collections to rotated api key").
+				WithFields(map[string]any{"entity": "api_key", "id": id}))
+		}
+		return nil
+	})
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+	repo.Invalidate(ctx, old.KeyHash)
+	repo.Invalidate(ctx, key.KeyHash)
+	return key, raw, nil
+}
+
+// rotatable reports why key cannot be rotated at now, if it cannot.
+func rotatable(key db.ApiKey, now time.Time) error {
+	switch {
+	case key.RevokedAt.Valid:
+		return apiKeyConflict(key.ID, "api key is revoked")
+	case key.ReplacedBy.Valid:
+		return apiKeyConflict(key.ID, "api key was already rotated").
+			WithField("replaced_by", key.ReplacedBy.Int64)
+	case key.ExpiresAt.Valid && !key.ExpiresAt.Time.After(now):
+		return apiKeyConflict(key.ID, "api key is expired")
+	}
+	return nil
+}
+
+func apiKeyConflict(id int64, msg string) *internal.Error {
+	return internal.NewError(internal.ErrorCodeConflict, msg).
+		WithFields(map[string]any{"entity": "api_key", "id": id})
+}
+
+// Revoke disables key id immediately on every replica.
+func (repo *APIKeyRepo) Revoke(ctx context.Context, id int64) (db.ApiKey, error) {
+	ctx, span := startSpan(ctx, "APIKeyRepo.Revoke")
+	defer span.End()
+	key, err := repo.Queries.RevokeAPIKey(ctx, id)
+	if err != nil {
+		return db.ApiKey{}, apiKeyLookupError(err, id)
+	}
+	repo.Invalidate(ctx, key.KeyHash)
+	return key, nil
+}
+
+// Invalidate drops the cached state for hash locally, in Redis and, via
+// pub/sub, on every other replica.
+func (repo *APIKeyRepo) Invalidate(ctx context.Context, hash string) {
+	repo.evictMemory(hash)
+	if repo.Redis == nil {
+		return
+	}
+	if err := repo.Redis.Del(ctx, apiKeyCachePrefix+hash).Err(); err != nil {
+		log.Warn().Err(err).Msg("failed to delete api key cache")
+	}
+	if err := repo.Redis.Publish(ctx, apiKeyInvalidationChannel, hash).Err(); err != nil {
+		log.Warn().Err(err).Msg("failed to publish api key invalidation")
+	}
+}
+
+// Subscribe evicts keys invalidated by other replicas until ctx is done.
+func (repo *APIKeyRepo) Subscribe(ctx context.Context) {
+	if repo.Redis == nil {
+		return
+	}
+	pubsub := repo.Redis.Subscribe(ctx, apiKeyInvalidationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			repo.evictMemory(msg.Payload)
+		}
+	}
+}
+
+func unknownUser(id int64) error {
+	return internal.NewError(internal.ErrorCodeInvalidArgument, "unknown user").
+		WithFields(map[string]any{"entity": "user", "id": id})
+}
+
+func apiKeyLookupError(err error, id int64) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return internal.NewError(internal.ErrorCodeNotFound, "api key not found").
+			WithFields(map[string]any{"entity": "api_key", "id": id})
+	}
+	return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get api key").
+		WithFields(map[string]any{"entity": "api_key", "id": id}))
+}
+
+// MarkUsed records that the key was used, writing at most once per
+// lastUsedResolution so hot keys do not turn every request into a write.
+func (repo *APIKeyRepo) MarkUsed(ctx context.Context, id int64) {
+	now := time.Now()
+	repo.mu.Lock()
+	if last, ok := repo.touched[id]; ok && now.Sub(last) < lastUsedResolution {
+		repo.mu.Unlock()
+		return
+	}
+	repo.touched[id] = now
+	repo.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		if err := repo.Queries.TouchAPIKey(ctx, id); err != nil {
+			log.Warn().Err(err).Int64("api_key_id", id).Msg("failed to update api key last use")
+		}
+	}()
+}
+
+func (repo *APIKeyRepo) fromMemory(hash string) (db.ApiKey, bool, bool) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	now := time.Now()
+	if entry, ok := repo.cache[hash]; ok && !now.After(entry.expires) {
+		return entry.key, true, true
+	}
+	if entry, ok := repo.misses[hash]; ok && !now.After(entry.expires) {
+		return db.ApiKey{}, false, true
+	}
+	return db.ApiKey{}, false, false
+}
+
+func (repo *APIKeyRepo) fromRedis(ctx context.Context, hash string) (db.ApiKey, bool, bool) {
+	if repo.Redis == nil {
+		return db.ApiKey{}, false, false
+	}
+	raw, err := repo.Redis.Get(ctx, apiKeyCachePrefix+hash).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Warn().Err(err).Msg("failed to read api key cache")
+		}
+		return db.ApiKey{}, false, false
+	}
+	var key db.ApiKey
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return db.ApiKey{}, false, false
+	}
+	repo.storeMemory(hash, key, true)
+	return key, true, true
+}
+
+func (repo *APIKeyRepo) store(ctx context.Context, hash string, key db.ApiKey, found bool) {
+	repo.storeMemory(hash, key, found)
+	// Only positive results are shared; misses stay local and short-lived.
+	if repo.Redis == nil || !found {
+		return
+	}
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return
+	}
+	if err := repo.Redis.Set(ctx, apiKeyCachePrefix+hash, raw, repo.TTL).Err(); err != nil {
+		log.Warn().Err(err).Msg("failed to write api key cache")
+	}
+}
+
+func (repo *APIKeyRepo) evictMemory(hash string) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.cache, hash)
+	delete(repo.misses, hash)
+}
+
+func (repo *APIKeyRepo) storeMemory(hash string, key db.ApiKey, found bool) {
+	now := time.Now()
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	entries, limit := repo.misses, maxCachedMissingAPIKeys
+	if found {
+		entries, limit = repo.cache, maxCachedAPIKeys
+		delete(repo.misses, hash)
+	} else {
+		delete(repo.cache, hash)
+	}
+	if _, ok := entries[hash]; !ok && len(entries) >= limit {
+		makeRoom(entries, limit, now)
+	}
+	entries[hash] = cachedAPIKey{key: key, expires: now.Add(repo.TTL)}
+}
+
+// makeRoom drops the expired entries, or a single arbitrary one when none
+// have expired, so a full cache keeps everything else it holds.
+func makeRoom(entries map[string]cachedAPIKey, limit int, now time.Time) {
+	for h, entry := range entries {
+		if now.After(entry.expires) {
+			delete(entries, h)
+		}
+	}
+	if len(entries) < limit {
+		return
+	}
+	for h := range entries {
+		delete(entries, h)
+		return
+	}
+}
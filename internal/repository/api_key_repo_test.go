@@ -0,0 +1,178 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/internal/repository"
+	"aka-project/tests"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyRepo_GetByKey_CachesLookups(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mockQ := tests.MockAPIKeys("good-key")
+	lookup := mockQ.GetAPIKeyByHashFunc
+	calls := 0
+	mockQ.GetAPIKeyByHashFunc = func(ctx context.Context, keyHash string) (db.ApiKey, error) {
+		calls++
+		return lookup(ctx, keyHash)
+	}
+
+	repo := repository.NewAPIKeyRepo(mockQ, rdb, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		key, err := repo.GetByKey(context.Background(), "good-key")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), key.ID)
+	}
+	assert.Equal(t, 1, calls)
+
+	// A second replica with a cold memory cache is served from Redis.
+	other := repository.NewAPIKeyRepo(mockQ, rdb, time.Minute)
+	_, err = other.GetByKey(context.Background(), "good-key")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	for i := 0; i < 2; i++ {
+		_, err = repo.GetByKey(context.Background(), "bad-key")
+		assert.True(t, errors.Is(err, internal.ErrUnauthorized))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestAPIKeyRepo_GetByKey_MissFloodKeepsValidKeys(t *testing.T) {
+	mockQ := tests.MockAPIKeys("good-key")
+	lookup := mockQ.GetAPIKeyByHashFunc
+	calls := 0
+	mockQ.GetAPIKeyByHashFunc = func(ctx context.Context, keyHash string) (db.ApiKey, error) {
+		calls++
+		return lookup(ctx, keyHash)
+	}
+
+	repo := repository.NewAPIKeyRepo(mockQ, nil, time.Minute)
+	_, err := repo.GetByKey(context.Background(), "good-key")
+	assert.NoError(t, err)
+
+	for i := 0; i < 20000; i++ {
+		_, err = repo.GetByKey(context.Background(), fmt.Sprintf("random-%d", i))
+		assert.True(t, errors.Is(err, internal.ErrUnauthorized))
+	}
+
+	calls = 0
+	_, err = repo.GetByKey(context.Background(), "good-key")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, calls)
+}
+
+func TestAPIKeyRepo_Revoke_InvalidatesOtherReplicas(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mockQ := tests.MockAPIKeys("good-key")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := repository.NewAPIKeyRepo(mockQ, rdb, time.Minute)
+	b := repository.NewAPIKeyRepo(mockQ, rdb, time.Minute)
+	go b.Subscribe(ctx)
+
+	// Warm b's memory cache, then revoke through a.
+	_, err = b.GetByKey(ctx, "good-key")
+	assert.NoError(t, err)
+	// Give the subscription time to register before publishing.
+	assert.Eventually(t, func() bool { return len(mr.PubSubChannels("")) > 0 }, time.Second, 10*time.Millisecond)
+
+	_, err = a.Revoke(ctx, 1)
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		key, err := b.GetByKey(ctx, "good-key")
+		return err == nil && key.RevokedAt.Valid
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestAPIKeyRepo_Rotate_Conflicts(t *testing.T) {
+	past := pgtype.Timestamptz{Time: time.Now().Add(-time.Hour), Valid: true}
+	cases := []struct {
+		name string
+		key  db.ApiKey
+	}{
+		{"revoked", db.ApiKey{ID: 1, RevokedAt: past}},
+		{"expired", db.ApiKey{ID: 1, ExpiresAt: past}},
+		{"already rotated", db.ApiKey{ID: 1, ReplacedBy: pgtype.Int8{Int64: 2, Valid: true}}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQ := &tests.MockQueries{
+				GetAPIKeyFunc: func(ctx context.Context, id int64) (db.ApiKey, error) { return tt.key, nil },
+			}
+			_, _, err := repository.NewAPIKeyRepo(mockQ, nil, time.Minute).Rotate(context.Background(), 1, time.Hour)
+			assert.True(t, errors.Is(err, internal.ErrConflict), "got %v", err)
+		})
+	}
+}
+
+func TestAPIKeyRepo_Rotate_LosesRace(t *testing.T) {
+	mockQ := &tests.MockQueries{
+		GetAPIKeyFunc: func(ctx context.Context, id int64) (db.ApiKey, error) {
+			return db.ApiKey{ID: id, Owner: "test"}, nil
+		},
+		CreateAPIKeyFunc: func(ctx context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+			return db.ApiKey{ID: 2, KeyHash: arg.KeyHash}, nil
+		},
+		// Another rotation committed its successor first.
+		RotateOutAPIKeyFunc: func(ctx context.Context, arg db.RotateOutAPIKeyParams) (db.ApiKey, error) {
+			return db.ApiKey{}, pgx.ErrNoRows
+		},
+	}
+	_, _, err := repository.NewAPIKeyRepo(mockQ, nil, time.Minute).Rotate(context.Background(), 1, time.Hour)
+	assert.True(t, errors.Is(err, internal.ErrConflict), "got %v", err)
+}
+
+func TestAPIKeyRepo_EnsureKey_RejectsUnknownScopes(t *testing.T) {
+	// EnsureAPIKey is not mocked, so reaching the database would panic.
+	repo := repository.NewAPIKeyRepo(&tests.MockQueries{}, nil, time.Minute)
+	_, err := repo.EnsureKey(context.Background(), "raw", "bootstrap", "API_KEY", []string{"characters:read", "charaters:write"}, "free")
+	assert.True(t, errors.Is(err, internal.ErrInvalidArgument), "got %v", err)
+	assert.ErrorContains(t, err, "unknown scope")
+}
+
+func TestAPIKeyRepo_Rotate_MovesCollections(t *testing.T) {
+	var moved db.ReassignCollectionsParams
+	mockQ := &tests.MockQueries{
+		GetAPIKeyFunc: func(ctx context.Context, id int64) (db.ApiKey, error) {
+			return db.ApiKey{ID: id, Owner: "acme", Tenant: "acme"}, nil
+		},
+		CreateAPIKeyFunc: func(ctx context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+			return db.ApiKey{ID: 2, KeyHash: arg.KeyHash, Tenant: arg.Tenant}, nil
+		},
+		RotateOutAPIKeyFunc: func(ctx context.Context, arg db.RotateOutAPIKeyParams) (db.ApiKey, error) {
+			return db.ApiKey{ID: arg.ID, ReplacedBy: arg.ReplacedBy}, nil
+		},
+		ReassignCollectionsFunc: func(ctx context.Context, arg db.ReassignCollectionsParams) (int64, error) {
+			moved = arg
+			return 3, nil
+		},
+	}
+	key, _, err := repository.NewAPIKeyRepo(mockQ, nil, time.Minute).Rotate(context.Background(), 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), key.ID)
+	assert.Equal(t, db.ReassignCollectionsParams{NewOwner: "key:2", Tenant: "acme", OldOwner: "key:1"}, moved)
+}
@@ -3,21 +3,47 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"aka-project/internal"
 	"aka-project/internal/config"
 	"aka-project/internal/db"
 	"aka-project/internal/helper"
+	"aka-project/internal/tenant"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/rs/zerolog/log"
 )
 
 var RM_API_ENDPOINT string = config.Load().RMAPI
 
+// CharacterRepo serves upstream characters, which every tenant shares, and
+// custom characters and overrides, which belong to the tenant in the
+// context.
 type CharacterRepo struct {
 	Queries db.Querier
 	Fetch   func(ctx context.Context, url string) (*helper.APIResponse, error)
+
+	lastSync atomic.Int64
+}
+
+// CustomCharacterIDStart is the first ID of locally created characters.
+// Upstream IDs stay below it, so syncing never overwrites custom ones.
+const CustomCharacterIDStart = 1_000_000
+
+// Character is a character as served by the API: the stored record with any
+// local override applied.
+type Character struct {
+	db.Character
+	Nickname string   `json:"nickname,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Hidden   bool     `json:"hidden,omitempty"`
+	Custom   bool     `json:"custom,omitempty"`
 }
 
 type CharactersResponse struct {
@@ -27,7 +53,34 @@ type CharactersResponse struct {
 		Count int    `json:"count"`
 		Pages int    `json:"pages"`
 	} `json:"info"`
-	Results []db.Character `json:"results"`
+	Results []Character `json:"results"`
+}
+
+// NewCharacter describes a custom character to create.
+type NewCharacter struct {
+	Name     string
+	Status   string
+	Species  string
+	Type     string
+	Gender   string
+	Image    string
+	Nickname string
+	Tags     []string
+}
+
+// CharacterPatch changes a character's override. Nil fields are left
+// alone; an empty string drops that correction and falls back to the
+// stored value.
+type CharacterPatch struct {
+	Nickname *string
+	Name     *string
+	Status   *string
+	Species  *string
+	Type     *string
+	Gender   *string
+	Image    *string
+	Tags     *[]string
+	Hidden   *bool
 }
 
 func NewCharacterRepo(queries db.Querier, fetch func(ctx context.Context, url string) (*helper.APIResponse, error)) *CharacterRepo {
@@ -37,7 +90,35 @@ func NewCharacterRepo(queries db.Querier, fetch func(ctx context.Context, url st
 	}
 }
 
-func (repo *CharacterRepo) GetCharacters(ctx context.Context, species string, status string, origin string) (CharactersResponse, error) {
+// LastSync returns when characters were last fetched from upstream and
+// stored, or the zero time if they have not been since startup.
+func (repo *CharacterRepo) LastSync() time.Time {
+	if n := repo.lastSync.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// GetCharacters returns the first page of upstream characters matching the
+// filters together with the tenant's matching custom characters, all with
+// overrides applied. Filters are checked again against corrected species
+// and status; an upstream character corrected into a filter is only found
+// by a tag. Custom characters are served even when upstream has no match or
+// is unavailable. Info comes from upstream, with Count raised by the custom
+// characters served, so it may still count characters hidden or filtered
+// out locally. With a tag only locally tagged characters are considered and
+// upstream is not asked.
+func (repo *CharacterRepo) GetCharacters(ctx context.Context, species string, status string, origin string, tag string) (CharactersResponse, error) {
+	ctx, span := startSpan(ctx, "CharacterRepo.GetCharacters")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return CharactersResponse{}, err
+	}
+	if tag != "" {
+		return repo.getTaggedCharacters(ctx, tenantID, species, status, origin, tag)
+	}
+
 	url, err := url.Parse(RM_API_ENDPOINT)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse URL")
@@ -50,42 +131,381 @@ func (repo *CharacterRepo) GetCharacters(ctx context.Context, species string, st
 	query.Set("origin", origin)
 	url.RawQuery = query.Encode()
 
-	resp, err := repo.Fetch(ctx, url.String())
+	result := CharactersResponse{Results: []Character{}}
+	var upstream []db.Character
+	// fetchErr is returned when no custom character matches either.
+	resp, fetchErr := repo.Fetch(ctx, url.String())
+	switch {
+	case fetchErr == nil:
+		result.Info = resp.Info
+		upstream = upstreamCharacters(resp)
+		if err := repo.persistCharacters(ctx, upstream); err != nil {
+			return CharactersResponse{}, err
+		}
+		repo.lastSync.Store(time.Now().UnixNano())
+	case errors.Is(fetchErr, internal.ErrNotFound):
+		fetchErr = internal.Wrap(fetchErr, internal.NewError(internal.ErrorCodeNotFound, "no characters found"))
+	case errors.Is(fetchErr, internal.ErrUnavailable):
+		log.Error().Err(fetchErr).Msg("Failed to fetch characters")
+		fetchErr = internal.Wrap(fetchErr, internal.NewError(internal.ErrorCodeUnavailable, "characters source unavailable"))
+	default:
+		log.Error().Err(fetchErr).Msg("Failed to fetch characters")
+		return CharactersResponse{}, internal.Wrap(fetchErr, internal.NewError(internal.ErrorCodeInternal, "failed to fetch characters"))
+	}
+
+	// Custom characters have no origin, so an origin filter excludes them.
+	var custom []db.Character
+	if origin == "" {
+		custom, err = repo.Queries.ListCustomCharacters(ctx, tenantID)
+		if err != nil {
+			return CharactersResponse{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list custom characters"))
+		}
+	}
+
+	stored := append(upstream, custom...)
+	merged, err := repo.applyOverrides(ctx, stored)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to fetch characters")
-		return CharactersResponse{}, internal.NewError(internal.ErrorCodeInternal, "failed to fetch characters")
+		return CharactersResponse{}, err
+	}
+	customServed := 0
+	for i, c := range merged {
+		if c.Hidden || !keepsFilter(c, stored[i].Species, c.Species, species) || !keepsFilter(c, stored[i].Status, c.Status, status) {
+			continue
+		}
+		result.Results = append(result.Results, c)
+		if c.Custom {
+			customServed++
+		}
 	}
 
-	result := CharactersResponse{
-		Info:    resp.Info,
-		Results: []db.Character{},
+	if fetchErr != nil {
+		if customServed == 0 {
+			return CharactersResponse{}, fetchErr
+		}
+		log.Warn().Err(fetchErr).Msg("Serving custom characters only")
+	}
+	result.Info.Count += customServed
+	if result.Info.Pages == 0 && len(result.Results) > 0 {
+		result.Info.Pages = 1
 	}
+	return result, nil
+}
 
+// upstreamCharacters decodes the characters of resp, skipping malformed
+// ones and any in the custom ID range.
+func upstreamCharacters(resp *helper.APIResponse) []db.Character {
+	var characters []db.Character
 	for _, rawChar := range resp.Results {
 		var char db.Character
 		if err := json.Unmarshal(rawChar, &char); err != nil {
 			log.Error().Err(err).Msg("Failed to unmarshal character")
 			continue
 		}
-		result.Results = append(result.Results, char)
+		if char.ID >= CustomCharacterIDStart {
+			log.Warn().Int32("id", char.ID).Msg("Ignoring upstream character in the custom ID range")
+			continue
+		}
+		characters = append(characters, char)
 	}
+	return characters
+}
 
-	err = repo.persistCharacters(result.Results)
+// getTaggedCharacters serves a tag filter from the local tables, where tags
+// live. Origins are upstream names that are not stored, so they cannot be
+// combined with a tag.
+func (repo *CharacterRepo) getTaggedCharacters(ctx context.Context, tenantID, species, status, origin, tag string) (CharactersResponse, error) {
+	if origin != "" {
+		return CharactersResponse{}, internal.NewError(internal.ErrorCodeInvalidArgument, "tag cannot be combined with origin")
+	}
+	tagged, err := repo.Queries.ListCharactersByTag(ctx, db.ListCharactersByTagParams{
+		Tenant: tenantID,
+		Tag:    strings.ToLower(strings.TrimSpace(tag)),
+	})
+	if err != nil {
+		return CharactersResponse{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list tagged characters").
+			WithField("tag", tag))
+	}
+	merged, err := repo.applyOverrides(ctx, tagged)
 	if err != nil {
 		return CharactersResponse{}, err
 	}
 
+	result := CharactersResponse{Results: []Character{}}
+	for _, c := range merged {
+		if !c.Hidden && matchesFilter(c.Species, species) && matchesFilter(c.Status, status) {
+			result.Results = append(result.Results, c)
+		}
+	}
+	result.Info.Count = len(result.Results)
+	result.Info.Pages = 1
 	return result, nil
 }
 
-func (repo *CharacterRepo) persistCharacters(characters []db.Character) error {
-	missingCharacters, err := repo.getMissingCharacters(characters)
+// GetCharacter returns a stored character with its override applied,
+// including hidden ones. Other tenants' custom characters are not found.
+func (repo *CharacterRepo) GetCharacter(ctx context.Context, id int32) (Character, error) {
+	ctx, span := startSpan(ctx, "CharacterRepo.GetCharacter")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return Character{}, err
+	}
+	c, err := repo.Queries.GetCharacter(ctx, db.GetCharacterParams{ID: id, Tenant: tenantID})
+	if err != nil {
+		return Character{}, characterLookupError(err, id)
+	}
+	merged, err := repo.applyOverrides(ctx, []db.Character{c})
+	if err != nil {
+		return Character{}, err
+	}
+	return merged[0], nil
+}
+
+// CreateCustom stores a new character in the custom ID range, together
+// with its override when it has a nickname or tags.
+func (repo *CharacterRepo) CreateCustom(ctx context.Context, c NewCharacter, by string) (Character, error) {
+	ctx, span := startSpan(ctx, "CharacterRepo.CreateCustom")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return Character{}, err
+	}
+	var out Character
+	err = inTx(ctx, repo.Queries, func(q db.Querier) error {
+		created, err := q.CreateCustomCharacter(ctx, db.CreateCustomCharacterParams{
+			Name:    c.Name,
+			Status:  c.Status,
+			Species: c.Species,
+			Type:    c.Type,
+			Gender:  c.Gender,
+			Image:   c.Image,
+			Tenant:  tenantID,
+		})
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to create character").
+				WithField("entity", "character"))
+		}
+		if c.Nickname == "" && len(c.Tags) == 0 {
+			out = Character{Character: created, Custom: true}
+			return nil
+		}
+		out, err = patchOverride(ctx, q, tenantID, created, CharacterPatch{Nickname: &c.Nickname, Tags: &c.Tags}, by)
+		return err
+	})
+	return out, err
+}
+
+// Patch applies p to the override of character id, creating the override
+// if there is none yet. Concurrent patches of the same character apply one
+// after the other, so none is lost.
+func (repo *CharacterRepo) Patch(ctx context.Context, id int32, p CharacterPatch, by string) (Character, error) {
+	ctx, span := startSpan(ctx, "CharacterRepo.Patch")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return Character{}, err
+	}
+	var out Character
+	err = inTx(ctx, repo.Queries, func(q db.Querier) error {
+		c, err := q.GetCharacter(ctx, db.GetCharacterParams{ID: id, Tenant: tenantID})
+		if err != nil {
+			return characterLookupError(err, id)
+		}
+		out, err = patchOverride(ctx, q, tenantID, c, p, by)
+		return err
+	})
+	return out, err
+}
+
+// patchOverride merges p into the override of c under a row lock. q must
+// be bound to a transaction for the lock to hold until the write.
+func patchOverride(ctx context.Context, q db.Querier, tenantID string, c db.Character, p CharacterPatch, by string) (Character, error) {
+	id := c.ID
+	o, err := q.LockCharacterOverride(ctx, db.LockCharacterOverrideParams{Tenant: tenantID, CharacterID: id})
+	if err != nil {
+		return Character{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get character override").
+			WithFields(map[string]any{"entity": "character", "id": id}))
+	}
+
+	arg := db.UpsertCharacterOverrideParams{
+		Tenant:      tenantID,
+		CharacterID: id,
+		Nickname:    patchText(o.Nickname, p.Nickname),
+		Tags:        o.Tags,
+		Hidden:      o.Hidden,
+		Name:        patchText(o.Name, p.Name),
+		Status:      patchText(o.Status, p.Status),
+		Species:     patchText(o.Species, p.Species),
+		Type:        patchText(o.Type, p.Type),
+		Gender:      patchText(o.Gender, p.Gender),
+		Image:       patchText(o.Image, p.Image),
+		UpdatedBy:   by,
+	}
+	if p.Tags != nil {
+		arg.Tags = *p.Tags
+	}
+	if arg.Tags == nil {
+		arg.Tags = []string{}
+	}
+	if p.Hidden != nil {
+		arg.Hidden = *p.Hidden
+	}
+
+	o, err = q.UpsertCharacterOverride(ctx, arg)
+	if err != nil {
+		return Character{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to save character override").
+			WithFields(map[string]any{"entity": "character", "id": id}))
+	}
+	return applyOverride(c, o), nil
+}
+
+// Delete removes a custom character together with its override, or the
+// local override of an upstream one so it is served as upstream has it
+// again.
+func (repo *CharacterRepo) Delete(ctx context.Context, id int32) error {
+	ctx, span := startSpan(ctx, "CharacterRepo.Delete")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return inTx(ctx, repo.Queries, func(q db.Querier) error {
+		overrides, err := q.DeleteCharacterOverride(ctx, db.DeleteCharacterOverrideParams{Tenant: tenantID, CharacterID: id})
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to delete character override").
+				WithFields(map[string]any{"entity": "character", "id": id}))
+		}
+		if id < CustomCharacterIDStart {
+			if overrides == 0 {
+				return internal.NewError(internal.ErrorCodeNotFound, "character has no override").
+					WithFields(map[string]any{"entity": "character", "id": id})
+			}
+			return nil
+		}
+
+		deleted, err := q.DeleteCustomCharacter(ctx, db.DeleteCustomCharacterParams{ID: id, Tenant: tenantID})
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to delete character").
+				WithFields(map[string]any{"entity": "character", "id": id}))
+		}
+		if deleted == 0 {
+			return internal.NewError(internal.ErrorCodeNotFound, "character not found").
+				WithFields(map[string]any{"entity": "character", "id": id})
+		}
+		return nil
+	})
+}
+
+// byIDs returns the stored characters among ids that the tenant in ctx
+// can see, with overrides applied, keyed by ID.
+func (repo *CharacterRepo) byIDs(ctx context.Context, ids []int32) (map[int32]Character, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := repo.Queries.ListCharactersByIDs(ctx, db.ListCharactersByIDsParams{Ids: ids, Tenant: tenantID})
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list characters"))
+	}
+	merged, err := repo.applyOverrides(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	characters := make(map[int32]Character, len(merged))
+	for _, c := range merged {
+		characters[c.ID] = c
+	}
+	return characters, nil
+}
+
+func (repo *CharacterRepo) applyOverrides(ctx context.Context, characters []db.Character) ([]Character, error) {
+	if len(characters) == 0 {
+		return []Character{}, nil
+	}
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int32, 0, len(characters))
+	for _, c := range characters {
+		ids = append(ids, c.ID)
+	}
+	rows, err := repo.Queries.ListCharacterOverrides(ctx, db.ListCharacterOverridesParams{Tenant: tenantID, CharacterIds: ids})
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list character overrides"))
+	}
+	overrides := make(map[int32]db.CharacterOverride, len(rows))
+	for _, o := range rows {
+		overrides[o.CharacterID] = o
+	}
+
+	out := make([]Character, 0, len(characters))
+	for _, c := range characters {
+		out = append(out, applyOverride(c, overrides[c.ID]))
+	}
+	return out, nil
+}
+
+func applyOverride(c db.Character, o db.CharacterOverride) Character {
+	set := func(dst *string, v pgtype.Text) {
+		if v.Valid {
+			*dst = v.String
+		}
+	}
+	set(&c.Name, o.Name)
+	set(&c.Status, o.Status)
+	set(&c.Species, o.Species)
+	set(&c.Type, o.Type)
+	set(&c.Gender, o.Gender)
+	set(&c.Image, o.Image)
+	return Character{
+		Character: c,
+		Nickname:  o.Nickname.String,
+		Tags:      o.Tags,
+		Hidden:    o.Hidden,
+		Custom:    c.ID >= CustomCharacterIDStart,
+	}
+}
+
+func patchText(current pgtype.Text, v *string) pgtype.Text {
+	if v == nil {
+		return current
+	}
+	return pgtype.Text{String: *v, Valid: *v != ""}
+}
+
+func matchesFilter(value, filter string) bool {
+	return filter == "" || strings.EqualFold(value, filter)
+}
+
+// keepsFilter reports whether c, served with a value that was stored as
+// stored, matches filter. Upstream has already filtered the values it
+// returned, so only custom characters and corrected values are checked.
+func keepsFilter(c Character, stored, served, filter string) bool {
+	return (!c.Custom && served == stored) || matchesFilter(served, filter)
+}
+
+func characterLookupError(err error, id int32) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return internal.NewError(internal.ErrorCodeNotFound, "character not found").
+			WithFields(map[string]any{"entity": "character", "id": id})
+	}
+	return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get character").
+		WithFields(map[string]any{"entity": "character", "id": id}))
+}
+
+// persistCharacters stores upstream characters not seen before. It outlives
+// a cancelled request so a fetched page is not wasted, but stays in its
+// trace.
+func (repo *CharacterRepo) persistCharacters(ctx context.Context, characters []db.Character) error {
+	ctx = context.WithoutCancel(ctx)
+	missingCharacters, err := repo.getMissingCharacters(ctx, characters)
 	if err != nil {
 		return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get missing characters"))
 	}
 
 	for _, character := range missingCharacters {
-		_, err = repo.Queries.CreateCharacter(context.Background(), db.CreateCharacterParams{
+		_, err = repo.Queries.CreateCharacter(ctx, db.CreateCharacterParams{
 			ID:         character.ID,
 			Name:       character.Name,
 			Status:     character.Status,
@@ -99,20 +519,21 @@ func (repo *CharacterRepo) persistCharacters(characters []db.Character) error {
 			LocationID: character.LocationID,
 		})
 		if err != nil {
-			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to create character"))
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to create character").
+				WithFields(map[string]any{"entity": "character", "id": character.ID}))
 		}
 	}
 
 	return nil
 }
 
-func (repo *CharacterRepo) getMissingCharacters(characters []db.Character) ([]db.Character, error) {
+func (repo *CharacterRepo) getMissingCharacters(ctx context.Context, characters []db.Character) ([]db.Character, error) {
 	var ids []int32
 	for _, character := range characters {
 		ids = append(ids, character.ID)
 	}
 
-	missingIDs, err := repo.Queries.GetMissingCharacterIDs(context.Background(), ids)
+	missingIDs, err := repo.Queries.GetMissingCharacterIDs(ctx, ids)
 	if err != nil {
 		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get missing character IDs"))
 	}
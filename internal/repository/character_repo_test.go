@@ -2,14 +2,26 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"aka-project/internal"
 	"aka-project/internal/db"
+	"aka-project/internal/helper"
+	"aka-project/internal/tenant"
 	"aka-project/tests"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 )
 
+// tenantContext returns a context acting for the default tenant, as every
+// authenticated request does.
+func tenantContext() context.Context {
+	return tenant.WithTenant(context.Background(), tenant.Default)
+}
+
 func TestCharacterRepo_GetCharacters_CreatesMissing(t *testing.T) {
 	var createdCharacter db.Character
 
@@ -25,9 +37,259 @@ func TestCharacterRepo_GetCharacters_CreatesMissing(t *testing.T) {
 
 	repo := NewCharacterRepo(mockQuerier, tests.MockFetchOK)
 
-	_, err := repo.GetCharacters(context.Background(), "", "", "")
+	_, err := repo.GetCharacters(tenantContext(), "", "", "", "")
 	assert.NoError(t, err)
 
 	assert.Equal(t, int32(1), createdCharacter.ID)
 	assert.Equal(t, "Rick", createdCharacter.Name)
 }
+
+func TestCharacterRepo_GetCharacters_AppliesOverridesAndCustom(t *testing.T) {
+	mockQuerier := &tests.MockQueries{
+		MissingIDsFunc: func(ctx context.Context, ids []int32) ([]int32, error) {
+			return nil, nil
+		},
+		ListCustomCharactersFunc: func(ctx context.Context, tenant string) ([]db.Character, error) {
+			return []db.Character{
+				{ID: CustomCharacterIDStart, Name: "Evil Rick", Species: "Human", Status: "Alive"},
+				{ID: CustomCharacterIDStart + 1, Name: "Squanchy", Species: "Cat-Person", Status: "Alive"},
+			}, nil
+		},
+		ListCharacterOverridesFunc: func(ctx context.Context, arg db.ListCharacterOverridesParams) ([]db.CharacterOverride, error) {
+			return []db.CharacterOverride{
+				{CharacterID: 1, Nickname: pgtype.Text{String: "Grandpa", Valid: true}, Tags: []string{"c-137"}, Name: pgtype.Text{String: "Rick Sanchez", Valid: true}},
+				{CharacterID: CustomCharacterIDStart, Hidden: true},
+			}, nil
+		},
+	}
+
+	repo := NewCharacterRepo(mockQuerier, tests.MockFetchOK)
+
+	resp, err := repo.GetCharacters(tenantContext(), "human", "", "", "")
+	assert.NoError(t, err)
+	if assert.Len(t, resp.Results, 1) {
+		got := resp.Results[0]
+		assert.Equal(t, "Rick Sanchez", got.Name)
+		assert.Equal(t, "Grandpa", got.Nickname)
+		assert.Equal(t, []string{"c-137"}, got.Tags)
+		assert.False(t, got.Custom)
+	}
+	assert.Equal(t, 1, resp.Info.Count)
+}
+
+func TestCharacterRepo_Patch_KeepsUnsetFields(t *testing.T) {
+	var saved db.UpsertCharacterOverrideParams
+	mockQuerier := &tests.MockQueries{
+		GetCharacterFunc: func(ctx context.Context, arg db.GetCharacterParams) (db.Character, error) {
+			return db.Character{ID: arg.ID, Name: "Rick", Status: "Alive"}, nil
+		},
+		LockCharacterOverrideFunc: func(ctx context.Context, arg db.LockCharacterOverrideParams) (db.CharacterOverride, error) {
+			return db.CharacterOverride{
+				CharacterID: arg.CharacterID,
+				Nickname:    pgtype.Text{String: "Grandpa", Valid: true},
+				Status:      pgtype.Text{String: "Dead", Valid: true},
+				Tags:        []string{"c-137"},
+			}, nil
+		},
+		UpsertCharacterOverrideFunc: func(ctx context.Context, arg db.UpsertCharacterOverrideParams) (db.CharacterOverride, error) {
+			saved = arg
+			return db.CharacterOverride{
+				CharacterID: arg.CharacterID, Nickname: arg.Nickname, Tags: arg.Tags, Hidden: arg.Hidden,
+				Name: arg.Name, Status: arg.Status, UpdatedBy: arg.UpdatedBy,
+			}, nil
+		},
+	}
+	repo := NewCharacterRepo(mockQuerier, tests.MockFetchOK)
+
+	clear, hidden := "", true
+	got, err := repo.Patch(tenantContext(), 1, CharacterPatch{Status: &clear, Hidden: &hidden}, "key:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Alive", got.Status)
+	assert.Equal(t, "Grandpa", got.Nickname)
+	assert.True(t, got.Hidden)
+	assert.Equal(t, []string{"c-137"}, saved.Tags)
+	assert.Equal(t, "key:1", saved.UpdatedBy)
+}
+
+func TestCharacterRepo_Patch_NotFound(t *testing.T) {
+	mockQuerier := &tests.MockQueries{
+		GetCharacterFunc: func(ctx context.Context, arg db.GetCharacterParams) (db.Character, error) {
+			return db.Character{}, pgx.ErrNoRows
+		},
+	}
+	repo := NewCharacterRepo(mockQuerier, tests.MockFetchOK)
+
+	_, err := repo.Patch(tenantContext(), 42, CharacterPatch{}, "key:1")
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeNotFound, appErr.Code)
+	}
+}
+
+func TestCharacterRepo_Delete(t *testing.T) {
+	var customDeleted bool
+	mockQuerier := &tests.MockQueries{
+		DeleteCharacterOverrideFunc: func(ctx context.Context, arg db.DeleteCharacterOverrideParams) (int64, error) {
+			return 0, nil
+		},
+		DeleteCustomCharacterFunc: func(ctx context.Context, arg db.DeleteCustomCharacterParams) (int64, error) {
+			customDeleted = true
+			return 1, nil
+		},
+	}
+	repo := NewCharacterRepo(mockQuerier, tests.MockFetchOK)
+
+	assert.NoError(t, repo.Delete(tenantContext(), CustomCharacterIDStart))
+	assert.True(t, customDeleted)
+
+	var appErr *internal.Error
+	if assert.ErrorAs(t, repo.Delete(tenantContext(), 1), &appErr) {
+		assert.Equal(t, internal.ErrorCodeNotFound, appErr.Code)
+	}
+}
+
+func TestCharacterRepo_GetCharacters_ByTag(t *testing.T) {
+	var askedTag string
+	fetched := false
+	queries := &tests.MockQueries{
+		ListCharactersByTagFunc: func(ctx context.Context, arg db.ListCharactersByTagParams) ([]db.Character, error) {
+			askedTag = arg.Tag
+			return []db.Character{
+				{ID: 1, Name: "Rick", Species: "Human"},
+				{ID: 2, Name: "Birdperson", Species: "Bird-Person"},
+			}, nil
+		},
+	}
+	repo := NewCharacterRepo(queries, tests.MockFetchOK)
+	repo.Fetch = func(ctx context.Context, url string) (*helper.APIResponse, error) {
+		fetched = true
+		return tests.MockFetchOK(ctx, url)
+	}
+
+	resp, err := repo.GetCharacters(tenantContext(), "human", "", "", " Villain ")
+	assert.NoError(t, err)
+	assert.Equal(t, "villain", askedTag)
+	assert.False(t, fetched)
+	if assert.Len(t, resp.Results, 1) {
+		assert.Equal(t, "Rick", resp.Results[0].Name)
+	}
+	assert.Equal(t, 1, resp.Info.Count)
+
+	_, err = repo.GetCharacters(tenantContext(), "", "", "Earth", "villain")
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeInvalidArgument, appErr.Code)
+	}
+}
+
+// txQueries records the outcome of each transaction run through it.
+type txQueries struct {
+	*tests.MockQueries
+	outcomes []error
+}
+
+func (q *txQueries) InTx(ctx context.Context, fn func(db.Querier) error) error {
+	err := fn(q.MockQueries)
+	q.outcomes = append(q.outcomes, err)
+	return err
+}
+
+func TestCharacterRepo_CreateCustom_OneTransaction(t *testing.T) {
+	q := &txQueries{MockQueries: &tests.MockQueries{
+		CreateCustomCharacterFunc: func(ctx context.Context, arg db.CreateCustomCharacterParams) (db.Character, error) {
+			return db.Character{ID: CustomCharacterIDStart, Name: arg.Name}, nil
+		},
+		LockCharacterOverrideFunc: func(ctx context.Context, arg db.LockCharacterOverrideParams) (db.CharacterOverride, error) {
+			return db.CharacterOverride{CharacterID: arg.CharacterID}, nil
+		},
+		UpsertCharacterOverrideFunc: func(ctx context.Context, arg db.UpsertCharacterOverrideParams) (db.CharacterOverride, error) {
+			return db.CharacterOverride{}, errors.New("disk full")
+		},
+	}}
+	repo := NewCharacterRepo(q, tests.MockFetchOK)
+
+	_, err := repo.CreateCustom(tenantContext(), NewCharacter{Name: "Evil Morty", Nickname: "Mayor"}, "key:1")
+	assert.Error(t, err)
+	// The character and its override share a transaction, so the failed
+	// override rolls the character back too.
+	if assert.Len(t, q.outcomes, 1) {
+		assert.Error(t, q.outcomes[0])
+	}
+}
+
+func TestCharacterRepo_Delete_OneTransaction(t *testing.T) {
+	q := &txQueries{MockQueries: &tests.MockQueries{
+		DeleteCharacterOverrideFunc: func(ctx context.Context, arg db.DeleteCharacterOverrideParams) (int64, error) {
+			return 1, nil
+		},
+		DeleteCustomCharacterFunc: func(ctx context.Context, arg db.DeleteCustomCharacterParams) (int64, error) {
+			return 0, errors.New("connection reset")
+		},
+	}}
+	repo := NewCharacterRepo(q, tests.MockFetchOK)
+
+	assert.Error(t, repo.Delete(tenantContext(), CustomCharacterIDStart))
+	// The override is only gone if the character is too.
+	if assert.Len(t, q.outcomes, 1) {
+		assert.Error(t, q.outcomes[0])
+	}
+}
+
+func TestCharacterRepo_GetCharacters_CustomWithoutUpstream(t *testing.T) {
+	custom := &tests.MockQueries{
+		ListCustomCharactersFunc: func(ctx context.Context, tenant string) ([]db.Character, error) {
+			return []db.Character{{ID: CustomCharacterIDStart, Name: "Evil Rick", Species: "Human", Status: "Alive"}}, nil
+		},
+	}
+	cases := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"no upstream match", internal.ErrNotFound, internal.ErrorCodeNotFound},
+		{"upstream unavailable", internal.ErrUnavailable, internal.ErrorCodeUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fetch := func(ctx context.Context, url string) (*helper.APIResponse, error) { return nil, tc.err }
+
+			resp, err := NewCharacterRepo(custom, fetch).GetCharacters(tenantContext(), "human", "", "", "")
+			assert.NoError(t, err)
+			if assert.Len(t, resp.Results, 1) {
+				assert.Equal(t, "Evil Rick", resp.Results[0].Name)
+			}
+			assert.Equal(t, 1, resp.Info.Count)
+			assert.Equal(t, 1, resp.Info.Pages)
+
+			// Without a matching custom character the upstream error stands.
+			_, err = NewCharacterRepo(custom, fetch).GetCharacters(tenantContext(), "alien", "", "", "")
+			var appErr *internal.Error
+			if assert.ErrorAs(t, err, &appErr) {
+				assert.Equal(t, tc.code, appErr.Code)
+			}
+		})
+	}
+}
+
+func TestCharacterRepo_GetCharacters_FiltersCorrectedValues(t *testing.T) {
+	mockQuerier := &tests.MockQueries{
+		MissingIDsFunc: func(ctx context.Context, ids []int32) ([]int32, error) {
+			return nil, nil
+		},
+		ListCharacterOverridesFunc: func(ctx context.Context, arg db.ListCharacterOverridesParams) ([]db.CharacterOverride, error) {
+			return []db.CharacterOverride{{CharacterID: 1, Species: pgtype.Text{String: "Cronenberg", Valid: true}}}, nil
+		},
+	}
+	repo := NewCharacterRepo(mockQuerier, tests.MockFetchOK)
+
+	// Upstream matched Rick as human, but his species was corrected.
+	resp, err := repo.GetCharacters(tenantContext(), "human", "", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Results)
+
+	resp, err = repo.GetCharacters(tenantContext(), "", "alive", "", "")
+	assert.NoError(t, err)
+	if assert.Len(t, resp.Results, 1) {
+		assert.Equal(t, "Cronenberg", resp.Results[0].Species)
+	}
+}
@@ -3,6 +3,7 @@ package repository_test
 import (
 	"aka-project/internal/db"
 	"aka-project/internal/repository"
+	"aka-project/internal/tenant"
 	"aka-project/tests"
 	"context"
 	"reflect"
@@ -42,7 +43,7 @@ func TestGetCharacters_Success(t *testing.T) {
 	repo := repository.NewCharacterRepo((db.Querier)(nil), tests.MockFetchOK)
 	repo.Queries = (db.Querier)(mockQ)
 
-	resp, err := repo.GetCharacters(context.Background(), "Human", "Alive", "Earth")
+	resp, err := repo.GetCharacters(tenant.WithTenant(context.Background(), tenant.Default), "Human", "Alive", "Earth", "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -55,7 +56,7 @@ func TestGetCharacters_Success(t *testing.T) {
 func TestGetCharacters_FetchError(t *testing.T) {
 	repo := repository.NewCharacterRepo((*db.Queries)(nil), tests.MockFetchError)
 
-	_, err := repo.GetCharacters(context.Background(), "Human", "Alive", "Earth")
+	_, err := repo.GetCharacters(tenant.WithTenant(context.Background(), tenant.Default), "Human", "Alive", "Earth", "")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/internal/tenant"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CollectionRepo stores named, ordered groups of characters. Every
+// operation is scoped to the tenant in the context and to an owner;
+// collections of other tenants or owners behave as if they did not exist.
+type CollectionRepo struct {
+	Queries    db.Querier
+	Characters *CharacterRepo
+}
+
+func NewCollectionRepo(queries db.Querier, characters *CharacterRepo) *CollectionRepo {
+	return &CollectionRepo{
+		Queries:    queries,
+		Characters: characters,
+	}
+}
+
+// Collection is a collection with its items in order. Items is nil when
+// only the collection itself was loaded.
+type Collection struct {
+	db.Collection
+	Items []CollectionItem `json:"items,omitempty"`
+}
+
+// CollectionItem is a character in a collection, with overrides applied.
+type CollectionItem struct {
+	Position  int32     `json:"position"`
+	AddedAt   time.Time `json:"added_at"`
+	Character Character `json:"character"`
+}
+
+// CollectionInput holds the editable fields of a collection.
+type CollectionInput struct {
+	Name        string
+	Description string
+	Tags        []string
+}
+
+func (repo *CollectionRepo) Create(ctx context.Context, owner string, in CollectionInput) (Collection, error) {
+	ctx, span := startSpan(ctx, "CollectionRepo.Create")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return Collection{}, err
+	}
+	c, err := repo.Queries.CreateCollection(ctx, db.CreateCollectionParams{
+		Tenant:      tenantID,
+		Owner:       owner,
+		Name:        in.Name,
+		Description: in.Description,
+		Tags:        nonNilTags(in.Tags),
+	})
+	if err != nil {
+		return Collection{}, collectionWriteError(err, "failed to create collection", in.Name)
+	}
+	return Collection{Collection: c, Items: []CollectionItem{}}, nil
+}
+
+// List returns the owner's collections by name, optionally only those
+// carrying tag.
+func (repo *CollectionRepo) List(ctx context.Context, owner, tag string) ([]db.Collection, error) {
+	ctx, span := startSpan(ctx, "CollectionRepo.List")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := repo.Queries.ListCollections(ctx, db.ListCollectionsParams{Tenant: tenantID, Owner: owner, Tag: tag})
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list collections"))
+	}
+	if collections == nil {
+		collections = []db.Collection{}
+	}
+	return collections, nil
+}
+
+// Get returns a collection with its items.
+func (repo *CollectionRepo) Get(ctx context.Context, owner string, id int64) (Collection, error) {
+	ctx, span := startSpan(ctx, "CollectionRepo.Get")
+	defer span.End()
+	c, err := repo.get(ctx, owner, id)
+	if err != nil {
+		return Collection{}, err
+	}
+	items, err := repo.items(ctx, id)
+	if err != nil {
+		return Collection{}, err
+	}
+	return Collection{Collection: c, Items: items}, nil
+}
+
+func (repo *CollectionRepo) Update(ctx context.Context, owner string, id int64, in CollectionInput) (Collection, error) {
+	ctx, span := startSpan(ctx, "CollectionRepo.Update")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return Collection{}, err
+	}
+	c, err := repo.Queries.UpdateCollection(ctx, db.UpdateCollectionParams{
+		ID:          id,
+		Tenant:      tenantID,
+		Owner:       owner,
+		Name:        in.Name,
+		Description: in.Description,
+		Tags:        nonNilTags(in.Tags),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Collection{}, collectionNotFound(id)
+	}
+	if err != nil {
+		return Collection{}, collectionWriteError(err, "failed to update collection", in.Name)
+	}
+	return Collection{Collection: c}, nil
+}
+
+func (repo *CollectionRepo) Delete(ctx context.Context, owner string, id int64) error {
+	ctx, span := startSpan(ctx, "CollectionRepo.Delete")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	deleted, err := repo.Queries.DeleteCollection(ctx, db.DeleteCollectionParams{ID: id, Tenant: tenantID, Owner: owner})
+	if err != nil {
+		return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to delete collection").
+			WithFields(map[string]any{"entity": "collection", "id": id}))
+	}
+	if deleted == 0 {
+		return collectionNotFound(id)
+	}
+	return nil
+}
+
+// AddItem appends a stored character to the end of a collection.
+func (repo *CollectionRepo) AddItem(ctx context.Context, owner string, id int64, characterID int32) (CollectionItem, error) {
+	ctx, span := startSpan(ctx, "CollectionRepo.AddItem")
+	defer span.End()
+	if _, err := repo.get(ctx, owner, id); err != nil {
+		return CollectionItem{}, err
+	}
+	character, err := repo.Characters.GetCharacter(ctx, characterID)
+	if err != nil {
+		return CollectionItem{}, err
+	}
+	// The next position is read and written under the collection's lock,
+	// so concurrent additions never share one.
+	var item db.CollectionItem
+	err = inTx(ctx, repo.Queries, func(q db.Querier) error {
+		if err := lockCollection(ctx, q, owner, id); err != nil {
+			return err
+		}
+		item, err = q.AddCollectionItem(ctx, db.AddCollectionItemParams{CollectionID: id, CharacterID: characterID})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return internal.NewError(internal.ErrorCodeConflict, "character is already in the collection").
+				WithFields(map[string]any{"entity": "collection", "id": id, "character_id": characterID})
+		}
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to add collection item").
+				WithFields(map[string]any{"entity": "collection", "id": id}))
+		}
+		return nil
+	})
+	if err != nil {
+		return CollectionItem{}, err
+	}
+	return CollectionItem{Position: item.Position, AddedAt: item.AddedAt, Character: character}, nil
+}
+
+func (repo *CollectionRepo) RemoveItem(ctx context.Context, owner string, id int64, characterID int32) error {
+	ctx, span := startSpan(ctx, "CollectionRepo.RemoveItem")
+	defer span.End()
+	if _, err := repo.get(ctx, owner, id); err != nil {
+		return err
+	}
+	removed, err := repo.Queries.RemoveCollectionItem(ctx, db.RemoveCollectionItemParams{CollectionID: id, CharacterID: characterID})
+	if err != nil {
+		return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to remove collection item").
+			WithFields(map[string]any{"entity": "collection", "id": id}))
+	}
+	if removed == 0 {
+		return internal.NewError(internal.ErrorCodeNotFound, "character is not in the collection").
+			WithFields(map[string]any{"entity": "collection", "id": id, "character_id": characterID})
+	}
+	return nil
+}
+
+// Reorder sets the order of a collection's items. characterIDs must list
+// every character in the collection exactly once.
+func (repo *CollectionRepo) Reorder(ctx context.Context, owner string, id int64, characterIDs []int32) ([]CollectionItem, error) {
+	ctx, span := startSpan(ctx, "CollectionRepo.Reorder")
+	defer span.End()
+	// The items are checked and reordered under the collection's lock, so
+	// an item added meanwhile cannot be left out of the new order.
+	err := inTx(ctx, repo.Queries, func(q db.Querier) error {
+		if err := lockCollection(ctx, q, owner, id); err != nil {
+			return err
+		}
+		current, err := q.ListCollectionItems(ctx, id)
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list collection items").
+				WithFields(map[string]any{"entity": "collection", "id": id}))
+		}
+		have := make([]int32, 0, len(current))
+		for _, item := range current {
+			have = append(have, item.CharacterID)
+		}
+		want := slices.Clone(characterIDs)
+		slices.Sort(have)
+		slices.Sort(want)
+		if !slices.Equal(have, want) {
+			return internal.NewError(internal.ErrorCodeInvalidArgument, "order must list every character in the collection exactly once")
+		}
+
+		if _, err := q.ReorderCollectionItems(ctx, db.ReorderCollectionItemsParams{
+			CharacterIds: characterIDs,
+			CollectionID: id,
+		}); err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to reorder collection").
+				WithFields(map[string]any{"entity": "collection", "id": id}))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo.items(ctx, id)
+}
+
+func (repo *CollectionRepo) get(ctx context.Context, owner string, id int64) (db.Collection, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return db.Collection{}, err
+	}
+	c, err := repo.Queries.GetCollection(ctx, db.GetCollectionParams{ID: id, Tenant: tenantID, Owner: owner})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Collection{}, collectionNotFound(id)
+	}
+	if err != nil {
+		return db.Collection{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get collection").
+			WithFields(map[string]any{"entity": "collection", "id": id}))
+	}
+	return c, nil
+}
+
+// lockCollection locks a collection of owner until the transaction q is
+// bound to ends.
+func lockCollection(ctx context.Context, q db.Querier, owner string, id int64) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = q.LockCollection(ctx, db.LockCollectionParams{ID: id, Tenant: tenantID, Owner: owner})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return collectionNotFound(id)
+	}
+	if err != nil {
+		return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to lock collection").
+			WithFields(map[string]any{"entity": "collection", "id": id}))
+	}
+	return nil
+}
+
+// items loads a collection's items in order with their characters.
+func (repo *CollectionRepo) items(ctx context.Context, id int64) ([]CollectionItem, error) {
+	rows, err := repo.Queries.ListCollectionItems(ctx, id)
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list collection items").
+			WithFields(map[string]any{"entity": "collection", "id": id}))
+	}
+	if len(rows) == 0 {
+		return []CollectionItem{}, nil
+	}
+
+	ids := make([]int32, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.CharacterID)
+	}
+	characters, err := repo.Characters.byIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]CollectionItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, CollectionItem{
+			Position:  row.Position,
+			AddedAt:   row.AddedAt,
+			Character: characters[row.CharacterID],
+		})
+	}
+	return items, nil
+}
+
+func collectionNotFound(id int64) error {
+	return internal.NewError(internal.ErrorCodeNotFound, "collection not found").
+		WithFields(map[string]any{"entity": "collection", "id": id})
+}
+
+func collectionWriteError(err error, msg, name string) error {
+	if isUniqueViolation(err) {
+		return internal.NewError(internal.ErrorCodeConflict, "a collection with this name already exists").
+			WithFields(map[string]any{"entity": "collection", "name": name})
+	}
+	return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, msg).
+		WithFields(map[string]any{"entity": "collection", "name": name}))
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
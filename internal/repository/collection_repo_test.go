@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/tests"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// collectionQueries serves collection 1 owned by "key:1" holding characters
+// 1, 2 and 3 in that order.
+func collectionQueries() *tests.MockQueries {
+	items := []db.CollectionItem{
+		{CollectionID: 1, CharacterID: 1, Position: 0},
+		{CollectionID: 1, CharacterID: 2, Position: 1},
+		{CollectionID: 1, CharacterID: 3, Position: 2},
+	}
+	return &tests.MockQueries{
+		GetCollectionFunc: func(ctx context.Context, arg db.GetCollectionParams) (db.Collection, error) {
+			if arg.ID != 1 || arg.Owner != "key:1" {
+				return db.Collection{}, pgx.ErrNoRows
+			}
+			return db.Collection{ID: 1, Owner: "key:1", Name: "season 1 villains"}, nil
+		},
+		LockCollectionFunc: func(ctx context.Context, arg db.LockCollectionParams) (db.Collection, error) {
+			if arg.ID != 1 || arg.Owner != "key:1" {
+				return db.Collection{}, pgx.ErrNoRows
+			}
+			return db.Collection{ID: 1, Owner: "key:1", Name: "season 1 villains"}, nil
+		},
+		ListCollectionItemsFunc: func(ctx context.Context, collectionID int64) ([]db.CollectionItem, error) {
+			sorted := slices.Clone(items)
+			slices.SortFunc(sorted, func(a, b db.CollectionItem) int { return int(a.Position - b.Position) })
+			return sorted, nil
+		},
+		ListCharactersByIDsFunc: func(ctx context.Context, arg db.ListCharactersByIDsParams) ([]db.Character, error) {
+			var out []db.Character
+			for _, id := range arg.Ids {
+				out = append(out, db.Character{ID: id, Name: map[int32]string{1: "Rick", 2: "Morty", 3: "Summer"}[id]})
+			}
+			return out, nil
+		},
+		ReorderCollectionItemsFunc: func(ctx context.Context, arg db.ReorderCollectionItemsParams) (int64, error) {
+			for i, id := range arg.CharacterIds {
+				items[id-1].Position = int32(i)
+			}
+			return int64(len(arg.CharacterIds)), nil
+		},
+	}
+}
+
+func TestCollectionRepo_Get_OtherOwnerNotFound(t *testing.T) {
+	queries := collectionQueries()
+	repo := NewCollectionRepo(queries, NewCharacterRepo(queries, tests.MockFetchOK))
+
+	c, err := repo.Get(tenantContext(), "key:1", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, c.Items, 3) {
+		assert.Equal(t, "Morty", c.Items[1].Character.Name)
+	}
+
+	_, err = repo.Get(tenantContext(), "key:2", 1)
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeNotFound, appErr.Code)
+	}
+}
+
+func TestCollectionRepo_Reorder(t *testing.T) {
+	queries := collectionQueries()
+	repo := NewCollectionRepo(queries, NewCharacterRepo(queries, tests.MockFetchOK))
+
+	items, err := repo.Reorder(tenantContext(), "key:1", 1, []int32{3, 1, 2})
+	assert.NoError(t, err)
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Character.Name)
+	}
+	assert.Equal(t, []string{"Summer", "Rick", "Morty"}, names)
+
+	for _, order := range [][]int32{{1, 2}, {1, 2, 2}, {1, 2, 3, 4}} {
+		_, err := repo.Reorder(tenantContext(), "key:1", 1, order)
+		var appErr *internal.Error
+		if assert.ErrorAs(t, err, &appErr, "order %v", order) {
+			assert.Equal(t, internal.ErrorCodeInvalidArgument, appErr.Code)
+		}
+	}
+}
+
+func TestCollectionRepo_AddItem_Duplicate(t *testing.T) {
+	queries := collectionQueries()
+	queries.GetCharacterFunc = func(ctx context.Context, arg db.GetCharacterParams) (db.Character, error) {
+		return db.Character{ID: arg.ID, Name: "Rick"}, nil
+	}
+	queries.AddCollectionItemFunc = func(ctx context.Context, arg db.AddCollectionItemParams) (db.CollectionItem, error) {
+		if arg.CharacterID == 1 {
+			return db.CollectionItem{}, pgx.ErrNoRows
+		}
+		return db.CollectionItem{CollectionID: arg.CollectionID, CharacterID: arg.CharacterID, Position: 3, AddedAt: time.Now()}, nil
+	}
+	repo := NewCollectionRepo(queries, NewCharacterRepo(queries, tests.MockFetchOK))
+
+	item, err := repo.AddItem(tenantContext(), "key:1", 1, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), item.Position)
+
+	_, err = repo.AddItem(tenantContext(), "key:1", 1, 1)
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeConflict, appErr.Code)
+	}
+}
+
+func TestCollectionRepo_PositionsChangeUnderLock(t *testing.T) {
+	queries := collectionQueries()
+	queries.GetCharacterFunc = func(ctx context.Context, arg db.GetCharacterParams) (db.Character, error) {
+		return db.Character{ID: arg.ID, Name: "Beth"}, nil
+	}
+	var locked bool
+	lock := queries.LockCollectionFunc
+	queries.LockCollectionFunc = func(ctx context.Context, arg db.LockCollectionParams) (db.Collection, error) {
+		locked = true
+		return lock(ctx, arg)
+	}
+	queries.AddCollectionItemFunc = func(ctx context.Context, arg db.AddCollectionItemParams) (db.CollectionItem, error) {
+		assert.True(t, locked, "position read without the collection lock")
+		return db.CollectionItem{CollectionID: arg.CollectionID, CharacterID: arg.CharacterID, Position: 3}, nil
+	}
+	reorder := queries.ReorderCollectionItemsFunc
+	queries.ReorderCollectionItemsFunc = func(ctx context.Context, arg db.ReorderCollectionItemsParams) (int64, error) {
+		assert.True(t, locked, "reordered without the collection lock")
+		return reorder(ctx, arg)
+	}
+	q := &txQueries{MockQueries: queries}
+	repo := NewCollectionRepo(q, NewCharacterRepo(queries, tests.MockFetchOK))
+
+	_, err := repo.AddItem(tenantContext(), "key:1", 1, 4)
+	assert.NoError(t, err)
+	locked = false
+	_, err = repo.Reorder(tenantContext(), "key:1", 1, []int32{3, 2, 1})
+	assert.NoError(t, err)
+	// Each change locks, checks and writes in a single transaction.
+	assert.Equal(t, []error{nil, nil}, q.outcomes)
+
+	_, err = repo.Reorder(tenantContext(), "key:2", 1, []int32{3, 2, 1})
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeNotFound, appErr.Code)
+	}
+}
+
+func TestCollectionRepo_Create_DuplicateName(t *testing.T) {
+	queries := &tests.MockQueries{
+		CreateCollectionFunc: func(ctx context.Context, arg db.CreateCollectionParams) (db.Collection, error) {
+			return db.Collection{}, &pgconn.PgError{Code: pgUniqueViolation}
+		},
+	}
+	repo := NewCollectionRepo(queries, NewCharacterRepo(queries, tests.MockFetchOK))
+
+	_, err := repo.Create(tenantContext(), "key:1", CollectionInput{Name: "favourites"})
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeConflict, appErr.Code)
+	}
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a span per repository call, so the queries and cache
+// lookups it makes are grouped beneath it in the request's trace. The tracer
+// is looked up on each call so it follows the current global provider.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer("aka-project/internal/repository").Start(ctx, name)
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+
+	"aka-project/internal/db"
+)
+
+// transactor is implemented by queriers that can run fn in a transaction,
+// such as *db.Store.
+type transactor interface {
+	InTx(ctx context.Context, fn func(db.Querier) error) error
+}
+
+// inTx runs fn in a transaction when q supports them. Queriers that do not,
+// such as test doubles, run fn directly.
+func inTx(ctx context.Context, q db.Querier, fn func(db.Querier) error) error {
+	if t, ok := q.(transactor); ok {
+		return t.InTx(ctx, fn)
+	}
+	return fn(q)
+}
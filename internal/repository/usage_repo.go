@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/internal/tenant"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dayLayout   = "20060102"
+	monthLayout = "200601"
+	// usageRetention is how long per-endpoint counters stay in Redis. It
+	// must comfortably exceed the rollup interval so nothing is lost.
+	usageRetention = 8 * 24 * time.Hour
+)
+
+// Quota caps the calls a caller may make per UTC day and month. Zero means
+// no cap for that period.
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// ParseQuota parses "daily/monthly", for example "1000/25000". Either side
+// may be 0 for no cap.
+func ParseQuota(spec string) (Quota, error) {
+	daily, monthly, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Quota{}, fmt.Errorf("invalid quota %q: want daily/monthly", spec)
+	}
+	d, err := strconv.ParseInt(strings.TrimSpace(daily), 10, 64)
+	if err != nil || d < 0 {
+		return Quota{}, fmt.Errorf("invalid daily quota in %q", spec)
+	}
+	m, err := strconv.ParseInt(strings.TrimSpace(monthly), 10, 64)
+	if err != nil || m < 0 {
+		return Quota{}, fmt.Errorf("invalid monthly quota in %q", spec)
+	}
+	return Quota{Daily: d, Monthly: m}, nil
+}
+
+// QuotaUsage is a caller's consumption in the current periods.
+type QuotaUsage struct {
+	Day   int64
+	Month int64
+}
+
+// DayUsage is a caller's consumption on one day, broken down by endpoint.
+type DayUsage struct {
+	Date      string           `json:"date"`
+	Total     int64            `json:"total"`
+	Endpoints map[string]int64 `json:"endpoints"`
+}
+
+// UsageRepo counts calls per caller in Redis and periodically rolls the
+// per-endpoint counters up into the api_usage table. Callers are counted
+// per tenant, taken from the context.
+type UsageRepo struct {
+	Queries db.Querier
+	Redis   *redis.Client
+}
+
+func NewUsageRepo(queries db.Querier, redisClient *redis.Client) *UsageRepo {
+	return &UsageRepo{Queries: queries, Redis: redisClient}
+}
+
+// Consume adds cost to the caller's day and month counters and returns the
+// new totals.
+func (repo *UsageRepo) Consume(ctx context.Context, subject string, cost int64, now time.Time) (QuotaUsage, error) {
+	ctx, span := startSpan(ctx, "UsageRepo.Consume")
+	defer span.End()
+	t, err := tenant.Require(ctx)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	dayKey, monthKey := quotaKeys(t, subject, now)
+
+	var day, month *redis.IntCmd
+	_, err = repo.Redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		day = p.IncrBy(ctx, dayKey, cost)
+		p.Expire(ctx, dayKey, 48*time.Hour)
+		month = p.IncrBy(ctx, monthKey, cost)
+		p.Expire(ctx, monthKey, 32*24*time.Hour)
+		return nil
+	})
+	if err != nil {
+		return QuotaUsage{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeUnavailable, "failed to update quota").
+			WithField("subject", subject))
+	}
+	return QuotaUsage{Day: day.Val(), Month: month.Val()}, nil
+}
+
+// Refund gives back cost consumed by a request that was then rejected.
+func (repo *UsageRepo) Refund(ctx context.Context, subject string, cost int64, now time.Time) {
+	t, err := tenant.Require(ctx)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to refund quota")
+		return
+	}
+	dayKey, monthKey := quotaKeys(t, subject, now)
+	_, err = repo.Redis.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.DecrBy(ctx, dayKey, cost)
+		p.DecrBy(ctx, monthKey, cost)
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("subject", subject).Msg("failed to refund quota")
+	}
+}
+
+// Current returns the caller's consumption without changing it.
+func (repo *UsageRepo) Current(ctx context.Context, subject string, now time.Time) (QuotaUsage, error) {
+	ctx, span := startSpan(ctx, "UsageRepo.Current")
+	defer span.End()
+	t, err := tenant.Require(ctx)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	dayKey, monthKey := quotaKeys(t, subject, now)
+	vals, err := repo.Redis.MGet(ctx, dayKey, monthKey).Result()
+	if err != nil {
+		return QuotaUsage{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeUnavailable, "failed to read quota").
+			WithField("subject", subject))
+	}
+	return QuotaUsage{Day: redisInt(vals[0]), Month: redisInt(vals[1])}, nil
+}
+
+// Record counts one accepted call to endpoint for the usage report.
+func (repo *UsageRepo) Record(ctx context.Context, subject, endpoint string, now time.Time) {
+	t, err := tenant.Require(ctx)
+	if err != nil {
+		internal.LogError(log.Ctx(ctx), err).Msg("failed to record usage")
+		return
+	}
+	day := now.UTC().Format(dayLayout)
+	hashKey := usageHashKey(day, t, subject)
+	_, err = repo.Redis.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.HIncrBy(ctx, hashKey, endpoint, 1)
+		p.Expire(ctx, hashKey, usageRetention)
+		p.SAdd(ctx, usageSubjectsKey(day), t+":"+subject)
+		p.Expire(ctx, usageSubjectsKey(day), usageRetention)
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("subject", subject).Msg("failed to record usage")
+	}
+}
+
+// Rollup copies the counters of every day still held in Redis into
+// Postgres, so days missed while the rollup could not run are caught up.
+// Counts are written as absolute values, so concurrent or repeated rollups
+// are safe.
+func (repo *UsageRepo) Rollup(ctx context.Context, now time.Time) error {
+	ctx, span := startSpan(ctx, "UsageRepo.Rollup")
+	defer span.End()
+	for back := int(usageRetention / (24 * time.Hour)); back >= 0; back-- {
+		t := now.AddDate(0, 0, -back)
+		day := t.UTC().Format(dayLayout)
+		subjects, err := repo.Redis.SMembers(ctx, usageSubjectsKey(day)).Result()
+		if err != nil {
+			return internal.Wrap(err, internal.NewError(internal.ErrorCodeUnavailable, "failed to list usage subjects"))
+		}
+		for _, member := range subjects {
+			// Tenant IDs cannot contain ':', so the first one separates it
+			// from the subject.
+			tenantID, subject, _ := strings.Cut(member, ":")
+			counts, err := repo.Redis.HGetAll(ctx, usageHashKey(day, tenantID, subject)).Result()
+			if err != nil {
+				return internal.Wrap(err, internal.NewError(internal.ErrorCodeUnavailable, "failed to read usage"))
+			}
+			for endpoint, count := range counts {
+				err := repo.Queries.UpsertAPIUsage(ctx, db.UpsertAPIUsageParams{
+					Tenant:   tenantID,
+					Subject:  subject,
+					Day:      pgDate(t),
+					Endpoint: endpoint,
+					Count:    redisInt(count),
+				})
+				if err != nil {
+					return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to store usage").
+						WithFields(map[string]any{"tenant": tenantID, "subject": subject, "day": day}))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RunRollup calls Rollup every interval until ctx is done.
+func (repo *UsageRepo) RunRollup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := repo.Rollup(ctx, time.Now()); err != nil {
+				internal.LogError(&log.Logger, err).Msg("usage rollup failed")
+			}
+		}
+	}
+}
+
+// Usage returns the caller's consumption per day between from and to,
+// inclusive. Days still held in Redis are read live so the report does not
+// lag behind the rollup.
+func (repo *UsageRepo) Usage(ctx context.Context, subject string, from, to time.Time) ([]DayUsage, error) {
+	ctx, span := startSpan(ctx, "UsageRepo.Usage")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := repo.Queries.ListAPIUsage(ctx, db.ListAPIUsageParams{
+		Tenant:  tenantID,
+		Subject: subject,
+		FromDay: pgDate(from),
+		ToDay:   pgDate(to),
+	})
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list usage").
+			WithField("subject", subject))
+	}
+
+	days := map[string]map[string]int64{}
+	for _, row := range rows {
+		date := row.Day.Time.Format(time.DateOnly)
+		if days[date] == nil {
+			days[date] = map[string]int64{}
+		}
+		days[date][row.Endpoint] = row.Count
+	}
+
+	liveFrom := time.Now().UTC().Add(-usageRetention + 24*time.Hour)
+	for t := from.UTC(); !t.After(to.UTC()); t = t.Add(24 * time.Hour) {
+		if t.Before(liveFrom) {
+			continue
+		}
+		counts, err := repo.Redis.HGetAll(ctx, usageHashKey(t.Format(dayLayout), tenantID, subject)).Result()
+		if err != nil {
+			log.Warn().Err(err).Str("subject", subject).Msg("failed to read live usage")
+			break
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		live := make(map[string]int64, len(counts))
+		for endpoint, count := range counts {
+			live[endpoint] = redisInt(count)
+		}
+		days[t.Format(time.DateOnly)] = live
+	}
+
+	out := make([]DayUsage, 0, len(days))
+	for date, endpoints := range days {
+		d := DayUsage{Date: date, Endpoints: endpoints}
+		for _, n := range endpoints {
+			d.Total += n
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+func quotaKeys(tenantID, subject string, now time.Time) (string, string) {
+	now = now.UTC()
+	return "quota:" + tenantID + ":" + subject + ":d:" + now.Format(dayLayout),
+		"quota:" + tenantID + ":" + subject + ":m:" + now.Format(monthLayout)
+}
+
+func usageHashKey(day, tenantID, subject string) string {
+	return "usage:" + day + ":" + tenantID + ":" + subject
+}
+
+func usageSubjectsKey(day string) string {
+	return "usage:subjects:" + day
+}
+
+func pgDate(t time.Time) pgtype.Date {
+	t = t.UTC()
+	return pgtype.Date{Time: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), Valid: true}
+}
+
+func redisInt(v any) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
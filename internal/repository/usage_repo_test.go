@@ -0,0 +1,87 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aka-project/internal/db"
+	"aka-project/internal/repository"
+	"aka-project/internal/tenant"
+	"aka-project/tests"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageRepo_RollupAndUsage(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := tenant.WithTenant(context.Background(), "acme")
+
+	stored := map[string]db.ApiUsage{}
+	mockQ := &tests.MockQueries{
+		UpsertAPIUsageFunc: func(ctx context.Context, arg db.UpsertAPIUsageParams) error {
+			stored[arg.Day.Time.Format(time.DateOnly)+arg.Endpoint] = db.ApiUsage{
+				Tenant: arg.Tenant, Subject: arg.Subject, Day: arg.Day, Endpoint: arg.Endpoint, Count: arg.Count,
+			}
+			return nil
+		},
+		ListAPIUsageFunc: func(ctx context.Context, arg db.ListAPIUsageParams) ([]db.ApiUsage, error) {
+			out := []db.ApiUsage{{
+				Subject:  arg.Subject,
+				Day:      pgtype.Date{Time: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Valid: true},
+				Endpoint: "GET /characters",
+				Count:    7,
+			}}
+			for _, u := range stored {
+				out = append(out, u)
+			}
+			return out, nil
+		},
+	}
+	repo := repository.NewUsageRepo(mockQ, rdb)
+
+	now := time.Now()
+	repo.Record(ctx, "key:1", "GET /characters", now)
+	repo.Record(ctx, "key:1", "GET /characters", now)
+	repo.Record(ctx, "key:1", "GET /usage", now)
+
+	// A day the rollup missed, still within Redis retention.
+	missed := now.Add(-5 * 24 * time.Hour)
+	repo.Record(ctx, "key:1", "GET /characters", missed)
+
+	// Rollups write absolute counts, so running twice does not double count.
+	assert.NoError(t, repo.Rollup(ctx, now))
+	assert.NoError(t, repo.Rollup(ctx, now))
+	today := now.UTC().Format(time.DateOnly)
+	assert.Len(t, stored, 3)
+	assert.Equal(t, int64(1), stored[missed.UTC().Format(time.DateOnly)+"GET /characters"].Count)
+	assert.Equal(t, int64(2), stored[today+"GET /characters"].Count)
+	assert.Equal(t, "acme", stored[today+"GET /characters"].Tenant)
+	assert.Equal(t, "key:1", stored[today+"GET /characters"].Subject)
+
+	days, err := repo.Usage(ctx, "key:1", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), now)
+	assert.NoError(t, err)
+	if assert.Len(t, days, 3) {
+		assert.Equal(t, "2024-01-15", days[0].Date)
+		assert.Equal(t, int64(7), days[0].Total)
+		assert.Equal(t, today, days[2].Date)
+		assert.Equal(t, int64(3), days[2].Total)
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	q, err := repository.ParseQuota("1000/0")
+	assert.NoError(t, err)
+	assert.Equal(t, repository.Quota{Daily: 1000}, q)
+
+	for _, bad := range []string{"1000", "x/1", "1/-1"} {
+		_, err := repository.ParseQuota(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/internal/models"
+	"aka-project/internal/tenant"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UserRepo stores user accounts and their favorite characters. Users belong
+// to the tenant in the context; other tenants' users are not found.
+type UserRepo struct {
+	Queries    db.Querier
+	Characters *CharacterRepo
+}
+
+func NewUserRepo(queries db.Querier, characters *CharacterRepo) *UserRepo {
+	return &UserRepo{
+		Queries:    queries,
+		Characters: characters,
+	}
+}
+
+func (repo *UserRepo) Create(ctx context.Context, name, email string) (models.User, error) {
+	ctx, span := startSpan(ctx, "UserRepo.Create")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+	u, err := repo.Queries.CreateUser(ctx, db.CreateUserParams{Tenant: tenantID, Name: name, Email: email})
+	if isUniqueViolation(err) {
+		return models.User{}, internal.NewError(internal.ErrorCodeConflict, "a user with this email already exists").
+			WithField("entity", "user")
+	}
+	if err != nil {
+		return models.User{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to create user").
+			WithField("entity", "user"))
+	}
+	return toUser(u), nil
+}
+
+func (repo *UserRepo) Get(ctx context.Context, id int64) (models.User, error) {
+	ctx, span := startSpan(ctx, "UserRepo.Get")
+	defer span.End()
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+	u, err := repo.Queries.GetUser(ctx, db.GetUserParams{ID: id, Tenant: tenantID})
+	if err != nil {
+		return models.User{}, userLookupError(err, id)
+	}
+	return toUser(u), nil
+}
+
+// Favorites returns the user's favorite characters, oldest first, with
+// overrides applied.
+func (repo *UserRepo) Favorites(ctx context.Context, userID int64) ([]Character, error) {
+	ctx, span := startSpan(ctx, "UserRepo.Favorites")
+	defer span.End()
+	if _, err := repo.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	rows, err := repo.Queries.ListUserFavorites(ctx, userID)
+	if err != nil {
+		return nil, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to list favorites").
+			WithFields(map[string]any{"entity": "user", "id": userID}))
+	}
+	if len(rows) == 0 {
+		return []Character{}, nil
+	}
+
+	ids := make([]int32, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.CharacterID)
+	}
+	byID, err := repo.Characters.byIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	favorites := make([]Character, 0, len(rows))
+	for _, row := range rows {
+		if c, ok := byID[row.CharacterID]; ok {
+			favorites = append(favorites, c)
+		}
+	}
+	return favorites, nil
+}
+
+// AddFavorite marks a stored character as a favorite of the user. Adding
+// a favorite twice is not an error.
+func (repo *UserRepo) AddFavorite(ctx context.Context, userID int64, characterID int32) (Character, error) {
+	ctx, span := startSpan(ctx, "UserRepo.AddFavorite")
+	defer span.End()
+	if _, err := repo.Get(ctx, userID); err != nil {
+		return Character{}, err
+	}
+	character, err := repo.Characters.GetCharacter(ctx, characterID)
+	if err != nil {
+		return Character{}, err
+	}
+	if err := repo.Queries.AddUserFavorite(ctx, db.AddUserFavoriteParams{UserID: userID, CharacterID: characterID}); err != nil {
+		return Character{}, internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to add favorite").
+			WithFields(map[string]any{"entity": "user", "id": userID}))
+	}
+	return character, nil
+}
+
+func (repo *UserRepo) RemoveFavorite(ctx context.Context, userID int64, characterID int32) error {
+	ctx, span := startSpan(ctx, "UserRepo.RemoveFavorite")
+	defer span.End()
+	if _, err := repo.Get(ctx, userID); err != nil {
+		return err
+	}
+	removed, err := repo.Queries.RemoveUserFavorite(ctx, db.RemoveUserFavoriteParams{UserID: userID, CharacterID: characterID})
+	if err != nil {
+		return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to remove favorite").
+			WithFields(map[string]any{"entity": "user", "id": userID}))
+	}
+	if removed == 0 {
+		return internal.NewError(internal.ErrorCodeNotFound, "character is not a favorite").
+			WithFields(map[string]any{"entity": "user", "id": userID, "character_id": characterID})
+	}
+	return nil
+}
+
+func toUser(u db.User) models.User {
+	return models.User{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		Tenant:    u.Tenant,
+		CreatedAt: u.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func userLookupError(err error, id int64) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return internal.NewError(internal.ErrorCodeNotFound, "user not found").
+			WithFields(map[string]any{"entity": "user", "id": id})
+	}
+	return internal.Wrap(err, internal.NewError(internal.ErrorCodeInternal, "failed to get user").
+		WithFields(map[string]any{"entity": "user", "id": id}))
+}
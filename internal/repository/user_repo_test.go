@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/db"
+	"aka-project/tests"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func userQueries() *tests.MockQueries {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	return &tests.MockQueries{
+		GetUserFunc: func(ctx context.Context, arg db.GetUserParams) (db.User, error) {
+			if arg.ID != 1 {
+				return db.User{}, pgx.ErrNoRows
+			}
+			return db.User{ID: 1, Name: "Rick", Email: "rick@citadel.example", CreatedAt: created}, nil
+		},
+		ListUserFavoritesFunc: func(ctx context.Context, userID int64) ([]db.UserFavorite, error) {
+			return []db.UserFavorite{{UserID: 1, CharacterID: 3}, {UserID: 1, CharacterID: 1}}, nil
+		},
+		ListCharactersByIDsFunc: func(ctx context.Context, arg db.ListCharactersByIDsParams) ([]db.Character, error) {
+			return []db.Character{{ID: 1, Name: "Rick"}, {ID: 3, Name: "Summer"}}, nil
+		},
+	}
+}
+
+func TestUserRepo_Get_UsesModelsUser(t *testing.T) {
+	repo := NewUserRepo(userQueries(), nil)
+
+	u, err := repo.Get(tenantContext(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Rick", u.Name)
+	assert.Equal(t, "2026-03-01T11:00:00Z", u.CreatedAt)
+
+	_, err = repo.Get(tenantContext(), 2)
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeNotFound, appErr.Code)
+	}
+}
+
+func TestUserRepo_Favorites_KeepsOrder(t *testing.T) {
+	queries := userQueries()
+	repo := NewUserRepo(queries, NewCharacterRepo(queries, tests.MockFetchOK))
+
+	favorites, err := repo.Favorites(tenantContext(), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, favorites, 2) {
+		assert.Equal(t, "Summer", favorites[0].Name)
+		assert.Equal(t, "Rick", favorites[1].Name)
+	}
+}
+
+func TestUserRepo_Create_DuplicateEmail(t *testing.T) {
+	queries := &tests.MockQueries{
+		CreateUserFunc: func(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+			return db.User{}, &pgconn.PgError{Code: pgUniqueViolation}
+		},
+	}
+	repo := NewUserRepo(queries, nil)
+
+	_, err := repo.Create(tenantContext(), "Rick", "rick@citadel.example")
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, internal.ErrorCodeConflict, appErr.Code)
+	}
+}
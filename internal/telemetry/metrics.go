@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Metrics exporter modes.
+const (
+	// MetricsOTLP pushes metrics to the collector over OTLP gRPC.
+	MetricsOTLP = "otlp"
+	// MetricsPrometheus serves them for scraping.
+	MetricsPrometheus = "prometheus"
+	MetricsBoth       = "both"
+	// MetricsNone records metrics without exporting them.
+	MetricsNone = "none"
+)
+
+// NewMeterProvider builds a meter provider exporting in mode. The otlp and
+// both modes push to endpoint, the collector URL traces are exported to. For
+// the prometheus and both modes it also returns the scrape handler, which
+// includes Go runtime and process metrics; otherwise the handler is nil.
+func NewMeterProvider(ctx context.Context, mode, endpoint string) (*sdkmetric.MeterProvider, http.Handler, error) {
+	var (
+		opts    []sdkmetric.Option
+		handler http.Handler
+	)
+	switch mode {
+	case MetricsOTLP, MetricsPrometheus, MetricsBoth, MetricsNone:
+	default:
+		return nil, nil, fmt.Errorf("unknown metrics exporter %q", mode)
+	}
+
+	if mode == MetricsOTLP || mode == MetricsBoth {
+		if endpoint == "" {
+			return nil, nil, fmt.Errorf("metrics exporter %q needs an OTLP endpoint", mode)
+		}
+		exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(endpoint))
+		if err != nil {
+			return nil, nil, fmt.Errorf("otlp metric exporter: %w", err)
+		}
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+	}
+
+	if mode == MetricsPrometheus || mode == MetricsBoth {
+		reg := prometheus.NewRegistry()
+		if err := reg.Register(collectors.NewGoCollector()); err != nil {
+			return nil, nil, err
+		}
+		if err := reg.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+			return nil, nil, err
+		}
+		exporter, err := otelprom.New(otelprom.WithRegisterer(reg))
+		if err != nil {
+			return nil, nil, fmt.Errorf("prometheus exporter: %w", err)
+		}
+		opts = append(opts, sdkmetric.WithReader(exporter))
+		handler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+	}
+
+	return sdkmetric.NewMeterProvider(opts...), handler, nil
+}
@@ -0,0 +1,161 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// unnamedQuery labels statements that do not come from sqlc, such as pings.
+const unnamedQuery = "unnamed"
+
+type pgxQueryKey struct{}
+
+type pgxQuery struct {
+	name  string
+	start time.Time
+}
+
+// PgxTracer is a pgx.QueryTracer that records a client span and a duration
+// sample per query, named after the sqlc query, and logs queries slower than
+// the configured threshold.
+type PgxTracer struct {
+	slow     time.Duration
+	duration metric.Float64Histogram
+}
+
+// NewPgxTracer records on meter; slow <= 0 disables slow-query logging.
+func NewPgxTracer(meter metric.Meter, slow time.Duration) (*PgxTracer, error) {
+	duration, err := meter.Float64Histogram(
+		"db.query_duration_seconds",
+		metric.WithDescription("Duration of Postgres queries, by sqlc query name and outcome"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(DurationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &PgxTracer{slow: slow, duration: duration}, nil
+}
+
+func (t *PgxTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	name := QueryName(data.SQL)
+	ctx, _ = otel.Tracer("aka-project/internal/telemetry/pgx").Start(ctx, "postgres "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", name),
+			attribute.String("db.statement", data.SQL),
+		))
+	return context.WithValue(ctx, pgxQueryKey{}, pgxQuery{name: name, start: time.Now()})
+}
+
+func (t *PgxTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	q, _ := ctx.Value(pgxQueryKey{}).(pgxQuery)
+	elapsed := time.Since(q.start)
+	rows := data.CommandTag.RowsAffected()
+	span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+
+	outcome := "ok"
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		outcome = "error"
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+	t.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(
+		attribute.String("db.operation", q.name),
+		attribute.String("outcome", outcome),
+	))
+
+	if t.slow > 0 && elapsed >= t.slow {
+		// Arguments are left out: they may carry user data.
+		queryLogger(ctx).Warn().
+			Str("query", q.name).
+			Dur("duration", elapsed).
+			Int64("rows", rows).
+			Msg("slow query")
+	}
+}
+
+// queryLogger prefers the request logger so slow queries carry the request
+// and trace IDs; background jobs fall back to the global logger.
+func queryLogger(ctx context.Context) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &log.Logger
+}
+
+// QueryName returns the sqlc query name from the "-- name: X :kind" header
+// sqlc puts at the top of each statement.
+func QueryName(sql string) string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(sql), "-- name: ")
+	if !ok {
+		return unnamedQuery
+	}
+	if name, _, ok := strings.Cut(rest, " "); ok && name != "" {
+		return name
+	}
+	return unnamedQuery
+}
+
+// RegisterPoolMetrics reports pool.Stat() on every collection.
+func RegisterPoolMetrics(meter metric.Meter, pool *pgxpool.Pool) error {
+	acquired, err := meter.Int64ObservableGauge("db.pool.acquired_connections",
+		metric.WithDescription("Connections currently checked out of the pool"))
+	if err != nil {
+		return err
+	}
+	idle, err := meter.Int64ObservableGauge("db.pool.idle_connections",
+		metric.WithDescription("Idle connections in the pool"))
+	if err != nil {
+		return err
+	}
+	total, err := meter.Int64ObservableGauge("db.pool.total_connections",
+		metric.WithDescription("Open connections, including those being established"))
+	if err != nil {
+		return err
+	}
+	maxConns, err := meter.Int64ObservableGauge("db.pool.max_connections",
+		metric.WithDescription("Maximum size of the pool"))
+	if err != nil {
+		return err
+	}
+	waits, err := meter.Int64ObservableCounter("db.pool.wait_count_total",
+		metric.WithDescription("Acquires that had to wait for a connection"))
+	if err != nil {
+		return err
+	}
+	waitDuration, err := meter.Float64ObservableCounter("db.pool.wait_duration_seconds_total",
+		metric.WithDescription("Time acquires spent waiting for a connection"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := pool.Stat()
+		o.ObserveInt64(acquired, int64(s.AcquiredConns()))
+		o.ObserveInt64(idle, int64(s.IdleConns()))
+		o.ObserveInt64(total, int64(s.TotalConns()))
+		o.ObserveInt64(maxConns, int64(s.MaxConns()))
+		o.ObserveInt64(waits, s.EmptyAcquireCount())
+		o.ObserveFloat64(waitDuration, s.EmptyAcquireWaitTime().Seconds())
+		return nil
+	}, acquired, idle, total, maxConns, waits, waitDuration)
+	return err
+}
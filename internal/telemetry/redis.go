@@ -0,0 +1,22 @@
+package telemetry
+
+import (
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentRedis adds a client span per command and the go-redis command
+// latency (db.client.connections.use_time, with an ok/error status) and
+// pool metrics. Command arguments are kept out of spans as they include API
+// key hashes.
+func InstrumentRedis(rdb *redis.Client, tp trace.TracerProvider, mp metric.MeterProvider) error {
+	if err := redisotel.InstrumentTracing(rdb,
+		redisotel.WithTracerProvider(tp),
+		redisotel.WithDBStatement(false),
+	); err != nil {
+		return err
+	}
+	return redisotel.InstrumentMetrics(rdb, redisotel.WithMeterProvider(mp))
+}
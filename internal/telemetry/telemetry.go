@@ -2,37 +2,81 @@ package telemetry
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
+// DurationBuckets are the request duration histogram boundaries in
+// seconds, from a fast cache hit to a slow upstream fetch with retries.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// SizeBuckets are the response size histogram boundaries in bytes.
+var SizeBuckets = []float64{100, 1_000, 10_000, 100_000, 1_000_000, 10_000_000}
+
 type Telemetry struct {
 	TracerProvider *sdktrace.TracerProvider
 	MeterProvider  *sdkmetric.MeterProvider
 	Meter          metric.Meter
 }
 
-func NewTelemetry(serviceName string) (*Telemetry, error) {
-	return NewTelemetryWithMeterProvider(serviceName, sdkmetric.NewMeterProvider())
+type options struct {
+	spanExporter sdktrace.SpanExporter
+	sampleRatio  float64
+}
+
+// Option configures NewTelemetryWithMeterProvider.
+type Option func(*options)
+
+// WithSpanExporter batches finished spans to exp. Without one spans are
+// still created and propagated, but not exported.
+func WithSpanExporter(exp sdktrace.SpanExporter) Option {
+	return func(o *options) { o.spanExporter = exp }
 }
 
-func NewTelemetryWithMeterProvider(serviceName string, mp *sdkmetric.MeterProvider) (*Telemetry, error) {
+// WithSampleRatio samples that fraction of new traces. Requests that carry
+// a sampled parent are always traced, so a trace is never cut in half.
+func WithSampleRatio(ratio float64) Option {
+	return func(o *options) { o.sampleRatio = ratio }
+}
+
+func NewTelemetry(serviceName string, opts ...Option) (*Telemetry, error) {
+	return NewTelemetryWithMeterProvider(serviceName, sdkmetric.NewMeterProvider(), opts...)
+}
+
+func NewTelemetryWithMeterProvider(serviceName string, mp *sdkmetric.MeterProvider, opts ...Option) (*Telemetry, error) {
+	o := options{sampleRatio: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	res := resource.NewWithAttributes(
 		semconv.SchemaURL,
 		semconv.ServiceNameKey.String(serviceName),
 	)
 
-	tp := sdktrace.NewTracerProvider(
+	tpOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-	)
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+	}
+	if o.spanExporter != nil {
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(o.spanExporter))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 
 	otel.SetMeterProvider(mp)
 
@@ -57,3 +101,33 @@ func (t *Telemetry) Shutdown(ctx context.Context) {
 		}
 	}
 }
+
+// ExportStatus records the errors OpenTelemetry reports, chiefly failed
+// exports, so the health checks can surface them. Install it with
+// otel.SetErrorHandler.
+type ExportStatus struct {
+	// Window is how long an error keeps Check failing.
+	Window time.Duration
+
+	mu      sync.Mutex
+	lastErr error
+	lastAt  time.Time
+}
+
+// Handle implements otel.ErrorHandler. Errors are still logged.
+func (s *ExportStatus) Handle(err error) {
+	log.Printf("opentelemetry: %v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr, s.lastAt = err, time.Now()
+}
+
+// Check fails while the latest error is younger than Window.
+func (s *ExportStatus) Check(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr == nil || time.Since(s.lastAt) > s.Window {
+		return nil
+	}
+	return fmt.Errorf("%s ago: %w", time.Since(s.lastAt).Round(time.Second), s.lastErr)
+}
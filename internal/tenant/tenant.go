@@ -0,0 +1,45 @@
+// Package tenant carries the tenant a request acts for. Every repository
+// reads it from the context and scopes its queries to it, so one tenant
+// can never see another's data.
+package tenant
+
+import (
+	"context"
+	"regexp"
+
+	"aka-project/internal"
+)
+
+// Default is the tenant of credentials that do not name one.
+const Default = "default"
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Valid reports whether name can be used as a tenant ID.
+func Valid(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx acting for tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant stored in ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Require returns the tenant stored in ctx. A missing tenant is a
+// programming error; failing here keeps an unscoped query from ever
+// reaching the database.
+func Require(ctx context.Context) (string, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return "", internal.NewError(internal.ErrorCodeInternal, "no tenant in context")
+	}
+	return id, nil
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aka-project/internal/admin"
+	"aka-project/internal/config"
+	"aka-project/internal/logger"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminRouter(t *testing.T) {
+	cfg := &config.Config{
+		DBUrl:          "postgres://postgres:hunter2@db:5432/myapp?sslmode=disable",
+		OTELCollector:  "https://collector.example:4317/?api_key=otel-token",
+		JWTJWKS:        "https://jwks-token@idp.example/.well-known/jwks.json",
+		RMAPI:          "https://rickandmortyapi.com/api/character",
+		RedisAddr:      "redis:6379",
+		APIKey:         "bootstrap-secret",
+		AdminAPIKey:    "admin-secret",
+		DebugLogSecret: "debug-secret",
+		Port:           "8080",
+	}
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("up 1\n")) })
+	report := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"status":"ok"}`)) })
+	h := admin.NewRouter(admin.Options{Metrics: metrics, Config: cfg.Redacted(), Health: report, AdminKey: cfg.AdminAPIKey})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	withKey := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Admin-Key", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// pprof needs the admin key.
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/debug/pprof/", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, withKey("GET", "/debug/pprof/", "wrong").Code)
+	assert.Equal(t, http.StatusOK, withKey("GET", "/debug/pprof/", "admin-secret").Code)
+	w := withKey("GET", "/debug/pprof/goroutine?debug=1", "admin-secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine profile")
+
+	assert.Equal(t, "up 1\n", do("GET", "/metrics", "").Body.String())
+	assert.JSONEq(t, `{"status":"ok"}`, do("GET", "/health", "").Body.String())
+
+	var info admin.BuildInfo
+	assert.NoError(t, json.NewDecoder(do("GET", "/buildinfo", "").Body).Decode(&info))
+	assert.Equal(t, "dev", info.Version)
+	assert.NotEmpty(t, info.GoVersion)
+
+	body := do("GET", "/config", "").Body.String()
+	assert.NotContains(t, body, "hunter2")
+	assert.NotContains(t, body, "bootstrap-secret")
+	assert.NotContains(t, body, "admin-secret")
+	assert.NotContains(t, body, "debug-secret")
+	assert.NotContains(t, body, "otel-token")
+	assert.NotContains(t, body, "jwks-token")
+	assert.Contains(t, body, `"DBUrl":"postgres://postgres:xxxxx@db:5432/myapp"`)
+	assert.Contains(t, body, `"OTELCollector":"https://collector.example:4317/"`)
+	assert.Contains(t, body, `"JWTJWKS":"https://xxxxx@idp.example/.well-known/jwks.json"`)
+	assert.Contains(t, body, `"RMAPI":"https://rickandmortyapi.com/api/character"`)
+	assert.Contains(t, body, `"RedisAddr":"redis:6379"`)
+	assert.Contains(t, body, `"APIKey":"REDACTED"`)
+	assert.Contains(t, body, `"DebugLogSecret":"REDACTED"`)
+	assert.Contains(t, body, `"Port":"8080"`)
+}
+
+func TestAdminRouter_WithoutMetrics(t *testing.T) {
+	h := admin.NewRouter(admin.Options{})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminRouter_LogLevel(t *testing.T) {
+	saved := logger.Level()
+	t.Cleanup(func() { logger.SetLevel(saved) })
+	logger.SetLevel(zerolog.InfoLevel)
+
+	h := admin.NewRouter(admin.Options{AdminKey: "admin-secret"})
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/loglevel", strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "admin-secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.JSONEq(t, `{"level":"info"}`, do("GET", "").Body.String())
+
+	// Reading the level is open; changing it needs the admin key.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/loglevel", strings.NewReader(`{"level":"debug"}`)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, zerolog.InfoLevel, logger.Level())
+
+	w = do("PUT", `{"level":"debug"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, zerolog.DebugLevel, logger.Level())
+	assert.JSONEq(t, `{"level":"debug"}`, do("GET", "").Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, do("PUT", `{"level":"loud"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", `{}`).Code)
+	assert.Equal(t, zerolog.DebugLevel, logger.Level())
+}
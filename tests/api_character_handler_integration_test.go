@@ -23,10 +23,14 @@ type fakeCharacterRepo struct {
 	returnError bool
 }
 
-func (f *fakeCharacterRepo) GetCharacters(ctx context.Context, species string, status string, origin string) (repository.CharactersResponse, error) {
+func (f *fakeCharacterRepo) GetCharacters(ctx context.Context, species string, status string, origin string, tag string) (repository.CharactersResponse, error) {
 	if f.returnError {
 		return repository.CharactersResponse{}, internal.NewError(internal.ErrorCodeInternal, "something went wrong")
 	}
+	results := make([]repository.Character, 0, len(f.users))
+	for _, u := range f.users {
+		results = append(results, repository.Character{Character: u})
+	}
 	return repository.CharactersResponse{
 		Info: struct {
 			Next  string `json:"next"`
@@ -34,7 +38,7 @@ func (f *fakeCharacterRepo) GetCharacters(ctx context.Context, species string, s
 			Count int    `json:"count"`
 			Pages int    `json:"pages"`
 		}{Next: "", Prev: "", Count: len(f.users), Pages: 1},
-		Results: f.users,
+		Results: results,
 	}, nil
 }
 
@@ -3,13 +3,17 @@ package tests
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"aka-project/internal/api"
+	"aka-project/internal/health"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
@@ -50,22 +54,226 @@ func TestHealthCheck(t *testing.T) {
 	db, redis := newTestDB(t), newTestRedis(t)
 
 	// Handler
-	hh := &api.HealthHandler{DB: db, Redis: redis}
+	checks := health.NewRegistry(time.Second, 0)
+	checks.Register(health.Check{Name: "postgres", Critical: true, Checker: health.CheckerFunc(db.Ping)})
+	checks.Register(health.Check{Name: "redis", Critical: true, Checker: health.CheckerFunc(func(ctx context.Context) error {
+		return redis.Ping(ctx).Err()
+	})})
+	hh := &api.HealthHandler{Checks: checks}
+	hh.MarkStarted()
 
 	// Request
-	req := httptest.NewRequest(http.MethodGet, "/healthcheck", nil)
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	w := httptest.NewRecorder()
 
-	hh.Check(w, req)
+	hh.Ready(w, req)
 
 	// Assert
-	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
 
 	var resp api.HealthStatus
 	err := json.NewDecoder(w.Body).Decode(&resp)
 	assert.NoError(t, err)
 
 	assert.Equal(t, "error", resp.Status)
-	assert.Equal(t, "error", resp.Checks["database"])
-	assert.Equal(t, "error", resp.Checks["redis"])
+	assert.Equal(t, "error", resp.Checks["postgres"].Status)
+	assert.Equal(t, "error", resp.Checks["redis"].Status)
+
+	// The errors are only in the detailed report.
+	w = httptest.NewRecorder()
+	hh.Details(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var report api.HealthReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.NotEmpty(t, report.Checks["postgres"].Error)
+}
+
+func TestHealthProbes(t *testing.T) {
+	hh := &api.HealthHandler{Checks: health.NewRegistry(time.Second, 0)}
+
+	probe := func(h http.HandlerFunc) (int, api.HealthStatus) {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		var resp api.HealthStatus
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return w.Code, resp
+	}
+
+	// Liveness never depends on startup, dependencies or draining.
+	code, resp := probe(hh.Live)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+
+	code, resp = probe(hh.Startup)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "starting", resp.Status)
+	code, _ = probe(hh.Ready)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	hh.MarkStarted()
+	code, _ = probe(hh.Startup)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Draining short-circuits before any dependency is pinged.
+	hh.Drain()
+	code, resp = probe(hh.Ready)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", resp.Status)
+	code, _ = probe(hh.Live)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestHealthRegistry_Degraded(t *testing.T) {
+	checks := health.NewRegistry(time.Second, 0)
+	checks.Register(health.Check{Name: "postgres", Critical: true, Checker: health.CheckerFunc(func(context.Context) error { return nil })})
+	checks.Register(health.Check{Name: "upstream", Checker: health.CheckerFunc(func(context.Context) error { return errors.New("boom") })})
+	hh := &api.HealthHandler{Checks: checks}
+	hh.MarkStarted()
+
+	w := httptest.NewRecorder()
+	hh.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	// Non-critical failures keep the pod in rotation.
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "boom", "the public probe must not leak errors")
+	var resp api.HealthStatus
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, health.StatusDegraded, resp.Status)
+	assert.Equal(t, health.StatusOK, resp.Checks["postgres"].Status)
+	assert.True(t, resp.Checks["postgres"].Critical)
+	assert.Equal(t, health.StatusError, resp.Checks["upstream"].Status)
+	assert.False(t, resp.Checks["upstream"].Critical)
+
+	w = httptest.NewRecorder()
+	hh.Details(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report api.HealthReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Equal(t, "boom", report.Checks["upstream"].Error)
+	assert.Equal(t, "boom", report.Checks["upstream"].LastError)
+}
+
+func TestHealthRegistry_ConcurrentWithTimeouts(t *testing.T) {
+	slow := health.CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checks := health.NewRegistry(50*time.Millisecond, 0)
+	checks.Register(health.Check{Name: "a", Critical: true, Checker: slow})
+	checks.Register(health.Check{Name: "b", Checker: slow})
+	checks.Register(health.Check{Name: "c", Checker: slow, Timeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	report := checks.Run(context.Background())
+
+	// The checks run side by side, so the run lasts about one timeout.
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, health.StatusError, report.Status)
+	assert.Contains(t, report.Checks["a"].Error, "timed out after 50ms")
+	assert.Contains(t, report.Checks["c"].Error, "timed out after 10ms")
+	assert.GreaterOrEqual(t, report.Checks["a"].LatencyMS, 50.0)
+}
+
+func TestHealthRegistry_CacheAndLastError(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	fail.Store(true)
+	checks := health.NewRegistry(time.Second, time.Hour)
+	checks.Register(health.Check{Name: "redis", Critical: true, Checker: health.CheckerFunc(func(context.Context) error {
+		calls.Add(1)
+		if fail.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})})
+
+	first := checks.Run(context.Background())
+	checks.Run(context.Background())
+	assert.Equal(t, int32(1), calls.Load(), "report should be cached for the TTL")
+	assert.Equal(t, health.StatusError, first.Status)
+
+	// Past the TTL the check runs again; the last error survives recovery.
+	checks = health.NewRegistry(time.Second, 0)
+	fail.Store(true)
+	checks.Register(health.Check{Name: "redis", Critical: true, Checker: health.CheckerFunc(func(context.Context) error {
+		if fail.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})})
+	checks.Run(context.Background())
+	fail.Store(false)
+	report := checks.Run(context.Background())
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Empty(t, report.Checks["redis"].Error)
+	assert.Equal(t, "connection refused", report.Checks["redis"].LastError)
+	assert.NotNil(t, report.Checks["redis"].LastErrorAt)
+}
+
+func TestHealthRegistry_PerCheckTTL(t *testing.T) {
+	var calls atomic.Int32
+	checks := health.NewRegistry(time.Second, 0)
+	checks.Register(health.Check{Name: "upstream", TTL: time.Hour, Checker: health.CheckerFunc(func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})})
+
+	checks.Run(context.Background())
+	checks.Run(context.Background())
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestHealthRegistry_SlowChecksRunInBackground(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	checks := health.NewRegistry(50*time.Millisecond, 0)
+	checks.Register(health.Check{Name: "upstream", Timeout: time.Second, Checker: health.CheckerFunc(func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		return errors.New("boom")
+	})})
+
+	// The probe does not wait for the slow check.
+	start := time.Now()
+	report := checks.Run(context.Background())
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, health.StatusPending, report.Checks["upstream"].Status)
+
+	// Runs while a refresh is in flight do not start another.
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	checks.Run(context.Background())
+	assert.Equal(t, int32(1), calls.Load())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return checks.Run(context.Background()).Status == health.StatusDegraded
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "boom", checks.Run(context.Background()).Checks["upstream"].Error)
+
+	assert.Panics(t, func() {
+		checks.Register(health.Check{Name: "postgres", Critical: true, Timeout: time.Second, Checker: health.CheckerFunc(func(context.Context) error { return nil })})
+	})
+}
+
+func TestHealthCheckers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer upstream.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, health.HTTPChecker{URL: upstream.URL + "/up"}.Check(ctx))
+	assert.ErrorContains(t, health.HTTPChecker{URL: upstream.URL + "/down"}.Check(ctx), "502")
+
+	var last time.Time
+	fresh := health.NewFreshnessChecker(func() time.Time { return last }, time.Minute)
+	assert.NoError(t, fresh.Check(ctx), "a new instance gets MaxAge to sync")
+	last = time.Now().Add(-2 * time.Minute)
+	assert.ErrorContains(t, fresh.Check(ctx), "last successful sync")
+	last = time.Now()
+	assert.NoError(t, fresh.Check(ctx))
 }
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/api"
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fake repo implements APIKeysRepo interface
+type fakeAPIKeysRepo struct {
+	keys  []db.ApiKey
+	grace time.Duration
+}
+
+func (f *fakeAPIKeysRepo) Create(ctx context.Context, k repository.NewAPIKey) (db.ApiKey, string, error) {
+	key := db.ApiKey{ID: int64(len(f.keys) + 1), Prefix: "aka_abcd", Owner: k.Owner, Label: k.Label, CreatedAt: time.Now()}
+	if k.UserID != nil {
+		key.UserID = pgtype.Int8{Int64: *k.UserID, Valid: true}
+	}
+	f.keys = append(f.keys, key)
+	return key, "aka_abcdsecret", nil
+}
+
+func (f *fakeAPIKeysRepo) List(ctx context.Context) ([]db.ApiKey, error) {
+	return f.keys, nil
+}
+
+func (f *fakeAPIKeysRepo) Rotate(ctx context.Context, id int64, grace time.Duration) (db.ApiKey, string, error) {
+	if id > int64(len(f.keys)) {
+		return db.ApiKey{}, "", internal.NewError(internal.ErrorCodeNotFound, "api key not found")
+	}
+	f.grace = grace
+	return f.Create(ctx, repository.NewAPIKey{Owner: f.keys[id-1].Owner})
+}
+
+func (f *fakeAPIKeysRepo) Revoke(ctx context.Context, id int64) (db.ApiKey, error) {
+	f.keys[id-1].RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return f.keys[id-1], nil
+}
+
+func newAdminRouter(repo api.APIKeysRepo) http.Handler {
+	h := &api.APIKeyHandler{Repo: repo, RotationGrace: time.Hour}
+	r := chi.NewRouter()
+	r.Route("/admin/api-keys", func(r chi.Router) {
+		r.Use(middleware.RequireAdminKey("admin-secret"))
+		r.Post("/", h.Create)
+		r.Get("/", h.List)
+		r.Post("/{id}/rotate", h.Rotate)
+		r.Delete("/{id}", h.Revoke)
+	})
+	return r
+}
+
+func TestAPIKeyHandler_Lifecycle(t *testing.T) {
+	repo := &fakeAPIKeysRepo{}
+	router := newAdminRouter(repo)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Admin-Key", "admin-secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create returns the secret once
+	w := do(http.MethodPost, "/admin/api-keys", `{"owner":"partner-a","label":"prod"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var created api.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "aka_abcdsecret", created.Key)
+	assert.Equal(t, "partner-a", created.Owner)
+
+	// List never exposes it
+	w = do(http.MethodGet, "/admin/api-keys", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.NotContains(t, w.Body.String(), "key_hash")
+
+	// Rotate uses the default grace unless one is given
+	w = do(http.MethodPost, "/admin/api-keys/1/rotate", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, time.Hour, repo.grace)
+	w = do(http.MethodPost, "/admin/api-keys/1/rotate", `{"grace_period":"10m"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 10*time.Minute, repo.grace)
+
+	w = do(http.MethodPost, "/admin/api-keys/99/rotate", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Revoke
+	w = do(http.MethodDelete, "/admin/api-keys/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, repo.keys[0].RevokedAt.Valid)
+
+	// Validation errors
+	w = do(http.MethodPost, "/admin/api-keys", `{"label":"no owner"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIKeyHandler_LinksUser(t *testing.T) {
+	router := newAdminRouter(&fakeAPIKeysRepo{})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/api-keys", bytes.NewBufferString(`{"user_id":42}`))
+	req.Header.Set("X-Admin-Key", "admin-secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created api.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "user:42", created.Owner)
+	if assert.NotNil(t, created.UserID) {
+		assert.Equal(t, int64(42), *created.UserID)
+	}
+}
+
+func TestAPIKeyHandler_RequiresAdminKey(t *testing.T) {
+	router := newAdminRouter(&fakeAPIKeysRepo{})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/api-keys", nil)
+	req.Header.Set("X-Admin-Key", "wrong")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aka-project/internal"
+	"aka-project/internal/api"
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCharacterWriteRepo implements api.CharacterWriteRepo.
+type fakeCharacterWriteRepo struct {
+	created repository.NewCharacter
+	patch   repository.CharacterPatch
+	by      string
+}
+
+func (f *fakeCharacterWriteRepo) CreateCustom(ctx context.Context, c repository.NewCharacter, by string) (repository.Character, error) {
+	f.created, f.by = c, by
+	return repository.Character{
+		Character: db.Character{ID: repository.CustomCharacterIDStart, Name: c.Name},
+		Nickname:  c.Nickname,
+		Tags:      c.Tags,
+		Custom:    true,
+	}, nil
+}
+
+func (f *fakeCharacterWriteRepo) Patch(ctx context.Context, id int32, p repository.CharacterPatch, by string) (repository.Character, error) {
+	if id == 404 {
+		return repository.Character{}, internal.NewError(internal.ErrorCodeNotFound, "character not found")
+	}
+	f.patch, f.by = p, by
+	c := repository.Character{Character: db.Character{ID: id, Name: "Rick"}}
+	if p.Nickname != nil {
+		c.Nickname = *p.Nickname
+	}
+	if p.Hidden != nil {
+		c.Hidden = *p.Hidden
+	}
+	return c, nil
+}
+
+func (f *fakeCharacterWriteRepo) Delete(ctx context.Context, id int32) error {
+	if id == 404 {
+		return internal.NewError(internal.ErrorCodeNotFound, "character has no override")
+	}
+	return nil
+}
+
+func newCharacterWriteRouter(repo api.CharacterWriteRepo, scopes ...string) http.Handler {
+	h := &api.CharacterWriteHandler{Repo: repo}
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := &auth.Identity{Method: auth.MethodAPIKey, KeyID: 7, Scopes: scopes}
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+		})
+	})
+	r.Use(middleware.RequireScope(auth.ScopeCharactersWrite))
+	r.Post("/characters", h.Create)
+	r.Patch("/characters/{id}", h.Patch)
+	r.Delete("/characters/{id}", h.Delete)
+	return r
+}
+
+func TestCharacterWriteHandler_Create(t *testing.T) {
+	repo := &fakeCharacterWriteRepo{}
+	router := newCharacterWriteRouter(repo, auth.ScopeCharactersWrite)
+
+	req := httptest.NewRequest(http.MethodPost, "/characters", bytes.NewBufferString(`{"name":" Squanchy ","tags":["Cat","cat "," friend"]}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "Squanchy", repo.created.Name)
+	assert.Equal(t, []string{"cat", "friend"}, repo.created.Tags)
+	assert.Equal(t, "key:7", repo.by)
+
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(repository.CustomCharacterIDStart), body["id"])
+	assert.Equal(t, true, body["custom"])
+}
+
+func TestCharacterWriteHandler_CreateValidation(t *testing.T) {
+	router := newCharacterWriteRouter(&fakeCharacterWriteRepo{}, auth.ScopeCharactersWrite)
+
+	for name, body := range map[string]string{
+		"missing name": `{"species":"Human"}`,
+		"bad json":     `{`,
+		"empty tag":    `{"name":"Rick","tags":[" "]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/characters", bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestCharacterWriteHandler_PatchAndDelete(t *testing.T) {
+	repo := &fakeCharacterWriteRepo{}
+	router := newCharacterWriteRouter(repo, auth.ScopeCharactersWrite)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPatch, "/characters/1", `{"nickname":"Grandpa","hidden":true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, repo.patch.Name)
+	assert.Contains(t, w.Body.String(), `"nickname":"Grandpa"`)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPatch, "/characters/404", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/characters/abc", `{}`).Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/characters/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/characters/404", "").Code)
+}
+
+func TestCharacterWriteHandler_RequiresWriteScope(t *testing.T) {
+	router := newCharacterWriteRouter(&fakeCharacterWriteRepo{}, auth.ScopeCharactersRead)
+
+	req := httptest.NewRequest(http.MethodDelete, "/characters/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"aka-project/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := middleware.NewClientIPResolver([]string{"10.0.0.0/8", "fd00::/8", "192.0.2.1"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{name: "direct ipv4", remote: "203.0.113.7:5555", want: "203.0.113.7"},
+		{name: "direct ipv6", remote: "[2001:db8::1]:5555", want: "2001:db8::1"},
+		{name: "ipv6 loopback", remote: "[::1]:8080", want: "::1"},
+		{name: "ipv4-mapped ipv6", remote: "[::ffff:203.0.113.7]:5555", want: "203.0.113.7"},
+		{name: "untrusted peer cannot spoof", remote: "203.0.113.7:5555", xff: []string{"1.2.3.4"}, realIP: "1.2.3.4", want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.1.2.3:5555", xff: []string{"198.51.100.9"}, want: "198.51.100.9"},
+		{name: "trusted single address", remote: "192.0.2.1:5555", xff: []string{"198.51.100.9"}, want: "198.51.100.9"},
+		{name: "spoofed entry left of real client", remote: "10.1.2.3:5555", xff: []string{"1.2.3.4, 198.51.100.9, 10.9.9.9"}, want: "198.51.100.9"},
+		{name: "multiple headers", remote: "10.1.2.3:5555", xff: []string{"1.2.3.4", "198.51.100.9"}, want: "198.51.100.9"},
+		{name: "ipv6 hops with ports", remote: "[fd00::1]:5555", xff: []string{"[2001:db8::2]:4711, fd00::2"}, want: "2001:db8::2"},
+		{name: "all hops trusted", remote: "10.1.2.3:5555", xff: []string{"10.4.4.4"}, want: "10.4.4.4"},
+		{name: "malformed hop", remote: "10.1.2.3:5555", xff: []string{"198.51.100.9, garbage"}, want: "10.1.2.3"},
+		{name: "x-real-ip from trusted proxy", remote: "10.1.2.3:5555", realIP: "198.51.100.9", want: "198.51.100.9"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remote
+			for _, v := range tc.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if tc.realIP != "" {
+				req.Header.Set("X-Real-IP", tc.realIP)
+			}
+			assert.Equal(t, tc.want, resolver.Resolve(req).String())
+		})
+	}
+
+	_, err = middleware.NewClientIPResolver([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestRateLimit_AnonymousCallersKeyedByResolvedIP(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mw, err := middleware.NewMiddleware(rdb, "1-M", nil)
+	assert.NoError(t, err)
+	resolver, err := middleware.NewClientIPResolver(nil)
+	assert.NoError(t, err)
+	handler := resolver.Middleware(mw.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	doReq := func(remote, spoofed string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", spoofed)
+		req.Header.Set("X-Real-IP", spoofed)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, doReq("[2001:db8::1]:1000", "1.1.1.1"))
+	// Rotating forwarding headers does not buy a fresh allowance.
+	assert.Equal(t, http.StatusTooManyRequests, doReq("[2001:db8::1]:2000", "2.2.2.2"))
+	assert.Equal(t, http.StatusOK, doReq("[2001:db8::2]:1000", "1.1.1.1"))
+}
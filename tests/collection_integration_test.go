@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"aka-project/internal"
+	"aka-project/internal/api"
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCollectionsRepo implements api.CollectionsRepo in memory.
+type fakeCollectionsRepo struct {
+	collections []repository.Collection
+}
+
+func (f *fakeCollectionsRepo) find(owner string, id int64) (*repository.Collection, error) {
+	for i := range f.collections {
+		if c := &f.collections[i]; c.ID == id && c.Owner == owner {
+			return c, nil
+		}
+	}
+	return nil, internal.NewError(internal.ErrorCodeNotFound, "collection not found")
+}
+
+func (f *fakeCollectionsRepo) Create(ctx context.Context, owner string, in repository.CollectionInput) (repository.Collection, error) {
+	c := repository.Collection{
+		Collection: db.Collection{ID: int64(len(f.collections) + 1), Owner: owner, Name: in.Name, Description: in.Description, Tags: in.Tags},
+		Items:      []repository.CollectionItem{},
+	}
+	f.collections = append(f.collections, c)
+	return c, nil
+}
+
+func (f *fakeCollectionsRepo) List(ctx context.Context, owner, tag string) ([]db.Collection, error) {
+	out := []db.Collection{}
+	for _, c := range f.collections {
+		if c.Owner == owner && (tag == "" || slices.Contains(c.Tags, tag)) {
+			out = append(out, c.Collection)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeCollectionsRepo) Get(ctx context.Context, owner string, id int64) (repository.Collection, error) {
+	c, err := f.find(owner, id)
+	if err != nil {
+		return repository.Collection{}, err
+	}
+	return *c, nil
+}
+
+func (f *fakeCollectionsRepo) Update(ctx context.Context, owner string, id int64, in repository.CollectionInput) (repository.Collection, error) {
+	c, err := f.find(owner, id)
+	if err != nil {
+		return repository.Collection{}, err
+	}
+	c.Name, c.Description, c.Tags = in.Name, in.Description, in.Tags
+	return *c, nil
+}
+
+func (f *fakeCollectionsRepo) Delete(ctx context.Context, owner string, id int64) error {
+	_, err := f.find(owner, id)
+	return err
+}
+
+func (f *fakeCollectionsRepo) AddItem(ctx context.Context, owner string, id int64, characterID int32) (repository.CollectionItem, error) {
+	c, err := f.find(owner, id)
+	if err != nil {
+		return repository.CollectionItem{}, err
+	}
+	item := repository.CollectionItem{
+		Position:  int32(len(c.Items)),
+		Character: repository.Character{Character: db.Character{ID: characterID}},
+	}
+	c.Items = append(c.Items, item)
+	return item, nil
+}
+
+func (f *fakeCollectionsRepo) RemoveItem(ctx context.Context, owner string, id int64, characterID int32) error {
+	_, err := f.find(owner, id)
+	return err
+}
+
+func (f *fakeCollectionsRepo) Reorder(ctx context.Context, owner string, id int64, characterIDs []int32) ([]repository.CollectionItem, error) {
+	c, err := f.find(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]repository.CollectionItem, 0, len(characterIDs))
+	for i, cid := range characterIDs {
+		items = append(items, repository.CollectionItem{Position: int32(i), Character: repository.Character{Character: db.Character{ID: cid}}})
+	}
+	c.Items = items
+	return items, nil
+}
+
+func newCollectionRouter(repo api.CollectionsRepo) http.Handler {
+	h := &api.CollectionHandler{Repo: repo}
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := &auth.Identity{Method: auth.MethodAPIKey, KeyID: 1, Scopes: []string{auth.ScopeCharactersRead, auth.ScopeCharactersWrite}}
+			if r.Header.Get("X-Test-Key") == "2" {
+				id.KeyID = 2
+			}
+			if r.Header.Get("X-Test-Read-Only") != "" {
+				id.Scopes = []string{auth.ScopeCharactersRead}
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+		})
+	})
+	r.With(middleware.RequireScope(auth.ScopeCharactersRead)).Get("/collections", h.List)
+	r.With(middleware.RequireScope(auth.ScopeCharactersRead)).Get("/collections/{id}", h.Get)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireScope(auth.ScopeCharactersWrite))
+		r.Post("/collections", h.Create)
+		r.Put("/collections/{id}", h.Update)
+		r.Delete("/collections/{id}", h.Delete)
+		r.Post("/collections/{id}/items", h.AddItem)
+		r.Put("/collections/{id}/items", h.Reorder)
+		r.Delete("/collections/{id}/items/{characterID}", h.RemoveItem)
+	})
+	return r
+}
+
+func TestCollectionHandler_Lifecycle(t *testing.T) {
+	router := newCollectionRouter(&fakeCollectionsRepo{})
+
+	do := func(method, path, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Test-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/collections", `{"name":"Season 1 villains","tags":["Villains"]}`, "1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "key:1", created["owner"])
+	assert.Equal(t, []any{"villains"}, created["tags"])
+
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/collections/1/items", `{"character_id":7}`, "1").Code)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/collections/1/items", `{"character_id":8}`, "1").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/collections/1/items", `{}`, "1").Code)
+
+	w = do(http.MethodPut, "/collections/1/items", `{"character_ids":[8,7]}`, "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var items []repository.CollectionItem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, int32(8), items[0].Character.ID)
+	}
+
+	w = do(http.MethodGet, "/collections?tag=villains", "", "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Season 1 villains")
+	assert.Equal(t, "[]\n", do(http.MethodGet, "/collections?tag=heroes", "", "1").Body.String())
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/collections/1", `{"name":"Villains"}`, "1").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/collections/1", `{"name":" "}`, "1").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/collections/1/items/7", "", "1").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/collections/1", "", "1").Code)
+}
+
+func TestCollectionHandler_OwnerIsolation(t *testing.T) {
+	router := newCollectionRouter(&fakeCollectionsRepo{})
+
+	do := func(method, path, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Test-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/collections", `{"name":"mine"}`, "1").Code)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/collections/1", "", "2").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/collections/1/items", `{"character_id":1}`, "2").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/collections/1", "", "2").Code)
+	assert.Equal(t, "[]\n", do(http.MethodGet, "/collections", "", "2").Body.String())
+}
+
+func TestCollectionHandler_ReadOnlyKeysCannotWrite(t *testing.T) {
+	router := newCollectionRouter(&fakeCollectionsRepo{})
+
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Test-Read-Only", "1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/collections", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/collections", `{"name":"mine"}`))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/collections/1", `{"name":"mine"}`))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/collections/1", ""))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/collections/1/items", `{"character_id":1}`))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/collections/1/items", `{"character_ids":[1]}`))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/collections/1/items/1", ""))
+}
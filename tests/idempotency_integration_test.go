@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	keys := repository.NewAPIKeyRepo(MockAPIKeys("key-a", "key-b"), rdb, time.Minute)
+	mw, err := middleware.NewMiddleware(rdb, "100-S", keys)
+	assert.NoError(t, err)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "slow" {
+			<-release
+		}
+		if string(body) == "boom" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/things/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d}`, n)
+	})
+	chain := mw.RequireAPIKey(middleware.Idempotency(rdb, time.Hour)(handler))
+
+	doReq := func(method, apiKey, idemKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/things", strings.NewReader(body))
+		req.Header.Set("X-API-Key", apiKey)
+		if idemKey != "" {
+			req.Header.Set(middleware.HeaderIdempotencyKey, idemKey)
+		}
+		w := httptest.NewRecorder()
+		chain.ServeHTTP(w, req)
+		return w
+	}
+
+	first := doReq("POST", "key-a", "k1", `{"name":"x"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, `{"id":1}`, first.Body.String())
+
+	// Retries replay the stored response without running the handler.
+	again := doReq("POST", "key-a", "k1", `{"name":"x"}`)
+	assert.Equal(t, http.StatusCreated, again.Code)
+	assert.Equal(t, `{"id":1}`, again.Body.String())
+	assert.Equal(t, "/things/1", again.Header().Get("Location"))
+	assert.Equal(t, "application/json", again.Header().Get("Content-Type"))
+	assert.Equal(t, "true", again.Header().Get(middleware.HeaderIdempotentReplayed))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Same key, different request.
+	w := doReq("POST", "key-a", "k1", `{"name":"y"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency-key-reused")
+
+	// Keys are scoped to the caller.
+	w = doReq("POST", "key-b", "k1", `{"name":"x"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Without a key, or on safe methods, nothing is stored.
+	doReq("POST", "key-a", "", `{"name":"x"}`)
+	doReq("GET", "key-a", "k1", "")
+	assert.Equal(t, int32(4), calls.Load())
+
+	// Server errors release the key so the retry runs for real.
+	w = doReq("POST", "key-a", "k-err", "boom")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	w = doReq("POST", "key-a", "k-err", "boom")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, int32(6), calls.Load())
+
+	// A retry while the first request is still running is rejected.
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- doReq("POST", "key-a", "k-slow", "slow") }()
+	assert.Eventually(t, func() bool { return calls.Load() == 7 }, time.Second, 5*time.Millisecond)
+	w = doReq("POST", "key-a", "k-slow", "slow")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency-key-in-use")
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+
+	// Entries expire after the configured window.
+	mr.FastForward(2 * time.Hour)
+	w = doReq("POST", "key-a", "k1", `{"name":"y"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestIdempotency_LostMarkerIsNotOverwritten(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := middleware.Idempotency(rdb, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest("POST", "/things", strings.NewReader("x"))
+		req.Header.Set(middleware.HeaderIdempotencyKey, "k1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	// The marker is replaced, as if it had lapsed and a retry had finished.
+	keys := mr.Keys()
+	if assert.Len(t, keys, 1) {
+		mr.Set(keys[0], "retry")
+	}
+	close(release)
+	<-done
+
+	got, _ := mr.Get(keys[0])
+	assert.Equal(t, "retry", got)
+}
+
+func TestIdempotency_AdminRequestsScopedToAdminKey(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	var calls atomic.Int32
+	handler := middleware.Idempotency(rdb, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	do := func(adminKey string) {
+		req := httptest.NewRequest("POST", "/admin/api-keys", strings.NewReader(`{}`))
+		req.Header.Set("X-Admin-Key", adminKey)
+		req.Header.Set(middleware.HeaderIdempotencyKey, "k1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Same client IP, so only the admin key tells the callers apart.
+	do("old-admin-key")
+	do("old-admin-key")
+	do("new-admin-key")
+	assert.Equal(t, int32(2), calls.Load())
+	for _, k := range mr.Keys() {
+		assert.NotContains(t, k, "admin-key", "the admin key is stored hashed")
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"aka-project/internal/db"
+	"aka-project/internal/ipfilter"
+	"aka-project/internal/middleware"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestIPFilter_AllowAndDenyPerGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[
+		{"group": "*", "action": "deny", "cidr": "198.51.100.0/24", "comment": "abusive network"},
+		{"group": "admin", "action": "allow", "cidr": "203.0.113.0/24", "comment": "office"},
+		{"group": "admin", "action": "allow", "cidr": "2001:db8:1::/48", "comment": "office v6"},
+		{"group": "admin", "action": "deny", "cidr": "203.0.113.66/32", "comment": "kiosk"}
+	]`), 0o600))
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	filter, err := ipfilter.New(context.Background(), ipfilter.FileSource{Path: path}, meter)
+	assert.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	resolver, err := middleware.NewClientIPResolver(nil)
+	assert.NoError(t, err)
+	api := resolver.Middleware(middleware.IPFilter(filter, "api")(ok))
+	admin := resolver.Middleware(middleware.IPFilter(filter, "admin")(ok))
+
+	doReq := func(h http.Handler, remote string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, doReq(api, "192.0.2.10:1000"))
+	assert.Equal(t, http.StatusForbidden, doReq(api, "198.51.100.7:1000"))
+	assert.Equal(t, http.StatusOK, doReq(admin, "203.0.113.5:1000"))
+	assert.Equal(t, http.StatusOK, doReq(admin, "[2001:db8:1::5]:1000"))
+	assert.Equal(t, http.StatusForbidden, doReq(admin, "203.0.113.66:1000"))
+	assert.Equal(t, http.StatusForbidden, doReq(admin, "192.0.2.10:1000"))
+	assert.Equal(t, http.StatusForbidden, doReq(admin, "198.51.100.7:1000"))
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	blocked := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "ip_filter.blocked_total" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				group, _ := dp.Attributes.Value("group")
+				rule, _ := dp.Attributes.Value("rule")
+				blocked[group.AsString()+" "+rule.AsString()] += dp.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{
+		"api deny 198.51.100.0/24":   1,
+		"admin deny 198.51.100.0/24": 1,
+		"admin deny 203.0.113.66/32": 1,
+		"admin default":              1,
+	}, blocked)
+}
+
+func TestIPFilter_ReloadsFromPostgresOnPublish(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	var mu sync.Mutex
+	rules := []db.IpRule{}
+	setRules := func(r ...db.IpRule) {
+		mu.Lock()
+		defer mu.Unlock()
+		rules = r
+	}
+	queries := &MockQueries{ListIPRulesFunc: func(ctx context.Context) ([]db.IpRule, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return rules, nil
+	}}
+	filter, err := ipfilter.New(context.Background(), ipfilter.DBSource{Queries: queries}, noop.NewMeterProvider().Meter("test"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go filter.Subscribe(ctx, rdb)
+
+	addr := netip.MustParseAddr("198.51.100.7")
+	assert.True(t, filter.Check(ctx, "api", addr).Allowed)
+
+	setRules(db.IpRule{ID: 1, RouteGroup: "api", Action: "deny", Cidr: netip.MustParsePrefix("198.51.100.0/24")})
+	assert.Eventually(t, func() bool {
+		rdb.Publish(ctx, ipfilter.ReloadChannel, "1")
+		return !filter.Check(ctx, "api", addr).Allowed
+	}, time.Second, 10*time.Millisecond)
+
+	// A broken rule set is rejected and the previous rules stay active.
+	setRules(db.IpRule{ID: 2, RouteGroup: "api", Action: "maybe", Cidr: netip.MustParsePrefix("10.0.0.0/8")})
+	assert.Error(t, filter.Reload(ctx))
+	assert.False(t, filter.Check(ctx, "api", addr).Allowed)
+}
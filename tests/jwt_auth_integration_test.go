@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aka-project/internal/auth"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeJWKS(t *testing.T, kid string, pub *rsa.PublicKey) string {
+	set := map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+	raw, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, raw, 0o600))
+	return path
+}
+
+func TestRequireAuth_AcceptsAPIKeyOrJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jwks, err := auth.NewJWKS(context.Background(), writeJWKS(t, "k1", &key.PublicKey), time.Hour)
+	assert.NoError(t, err)
+	verifier := auth.NewJWTVerifier(jwks, auth.JWTConfig{
+		Issuer:   "https://idp.example",
+		Audience: "aka-project",
+		ScopeMap: map[string][]string{"aka.read": {auth.ScopeCharactersRead}},
+	})
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mw, err := middleware.NewMiddleware(rdb, "10-S", repository.NewAPIKeyRepo(MockAPIKeys("api-key"), rdb, time.Minute))
+	assert.NoError(t, err)
+
+	var got *auth.Identity
+	handler := middleware.RequireAuth(mw.APIKeyAuth(), middleware.JWTAuth(verifier))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = auth.IdentityFromContext(r.Context())
+		}))
+
+	sign := func(k *rsa.PrivateKey, claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		s, err := tok.SignedString(k)
+		assert.NoError(t, err)
+		return s
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://idp.example",
+			"aud":   "aka-project",
+			"sub":   "svc-reporting",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "openid aka.read",
+		}
+	}
+	doReq := func(header, value string) int {
+		got = nil
+		req := httptest.NewRequest("GET", "/characters", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// API key still works
+	assert.Equal(t, http.StatusOK, doReq("X-API-Key", "api-key"))
+	assert.Equal(t, auth.MethodAPIKey, got.Method)
+
+	// Valid token maps claims to scopes
+	assert.Equal(t, http.StatusOK, doReq("Authorization", "Bearer "+sign(key, valid())))
+	assert.Equal(t, auth.MethodJWT, got.Method)
+	assert.Equal(t, "jwt:svc-reporting", got.Key())
+	assert.Equal(t, []string{auth.ScopeCharactersRead}, got.Scopes)
+
+	// Rejections
+	expired := valid()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAud := valid()
+	wrongAud["aud"] = "someone-else"
+	wrongIss := valid()
+	wrongIss["iss"] = "https://evil.example"
+	noExp := valid()
+	delete(noExp, "exp")
+
+	for name, token := range map[string]string{
+		"expired":   sign(key, expired),
+		"audience":  sign(key, wrongAud),
+		"issuer":    sign(key, wrongIss),
+		"no expiry": sign(key, noExp),
+		"bad sig":   sign(otherKey, valid()),
+		"garbage":   "not-a-token",
+	} {
+		assert.Equal(t, http.StatusUnauthorized, doReq("Authorization", "Bearer "+token), name)
+	}
+	assert.Equal(t, http.StatusUnauthorized, doReq("", ""))
+}
+
+func TestJWKS_BacksOffAndCoalescesFailedRefreshes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	raw, err := os.ReadFile(writeJWKS(t, "k1", &key.PublicKey))
+	assert.NoError(t, err)
+
+	var hits atomic.Int32
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			time.Sleep(50 * time.Millisecond)
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(raw)
+	}))
+	defer srv.Close()
+
+	jwks, err := auth.NewJWKS(context.Background(), srv.URL, time.Millisecond)
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	down.Store(true)
+
+	// Every caller sees a stale set; they share one fetch and keep the
+	// cached key when it fails.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwks.Key(context.Background(), "k1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), hits.Load())
+
+	// The failure is backed off, including for forged key IDs.
+	_, err = jwks.Key(context.Background(), "k1")
+	assert.NoError(t, err)
+	_, err = jwks.Key(context.Background(), "forged")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), hits.Load())
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"aka-project/internal/auth"
+	"aka-project/internal/logger"
+	"aka-project/internal/middleware"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs configures the global logger at level, writing to the
+// returned buffer until the test ends.
+func captureLogs(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	saved := log.Logger
+	t.Cleanup(func() {
+		log.Logger = saved
+		logger.SetLevel(zerolog.InfoLevel)
+	})
+	var buf bytes.Buffer
+	assert.NoError(t, logger.NewWriter(level, &buf))
+	return &buf
+}
+
+func TestLogger_Level(t *testing.T) {
+	buf := captureLogs(t, "warn")
+	assert.Equal(t, zerolog.WarnLevel, logger.Level())
+
+	log.Info().Msg("quiet")
+	log.Warn().Msg("loud")
+	assert.NotContains(t, buf.String(), "quiet")
+	assert.Contains(t, buf.String(), "loud")
+
+	// Derived loggers follow runtime changes.
+	derived := log.With().Str("component", "test").Logger()
+	logger.SetLevel(zerolog.DebugLevel)
+	derived.Debug().Msg("now visible")
+	assert.Contains(t, buf.String(), "now visible")
+}
+
+func TestLogger_SetLevelWhileServing(t *testing.T) {
+	saved := log.Logger
+	t.Cleanup(func() { log.Logger = saved; logger.SetLevel(zerolog.InfoLevel) })
+	assert.NoError(t, logger.NewWriter("info", io.Discard))
+	handler := middleware.Logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).Debug().Msg("request detail")
+	}))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters", nil))
+				}
+			}
+		}()
+	}
+	// Run under -race: changing the level must not race with request
+	// goroutines deriving and using loggers.
+	for i := 0; i < 100; i++ {
+		logger.SetLevel([]zerolog.Level{zerolog.DebugLevel, zerolog.InfoLevel}[i%2])
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestLogger_InvalidLevel(t *testing.T) {
+	saved := log.Logger
+	t.Cleanup(func() { log.Logger = saved; logger.SetLevel(zerolog.InfoLevel) })
+
+	assert.Error(t, logger.New("loud"))
+	assert.Equal(t, zerolog.InfoLevel, logger.Level())
+}
+
+func TestDebugLog(t *testing.T) {
+	const secret = "debug-secret"
+	admin := &auth.Identity{Subject: "ops", Scopes: []string{auth.ScopeAdmin}}
+	reader := &auth.Identity{Subject: "client", Scopes: []string{auth.ScopeCharactersRead}}
+
+	tests := []struct {
+		name    string
+		id      *auth.Identity
+		header  string
+		enabled bool
+	}{
+		{"admin with valid token", admin, middleware.DebugLogToken(secret, time.Now().Add(time.Minute)), true},
+		{"no header", admin, "", false},
+		{"expired token", admin, middleware.DebugLogToken(secret, time.Now().Add(-time.Minute)), false},
+		{"expiry too far ahead", admin, middleware.DebugLogToken(secret, time.Now().Add(24*time.Hour)), false},
+		{"wrong secret", admin, middleware.DebugLogToken("other", time.Now().Add(time.Minute)), false},
+		{"malformed", admin, "garbage", false},
+		{"not an admin", reader, middleware.DebugLogToken(secret, time.Now().Add(time.Minute)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLogs(t, "info")
+
+			withID := func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), tt.id)))
+				})
+			}
+			handler := middleware.Logger(withID(middleware.DebugLog(secret)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					zerolog.Ctx(r.Context()).Debug().Msg("request detail")
+				}))))
+
+			req := httptest.NewRequest(http.MethodGet, "/characters", nil)
+			if tt.header != "" {
+				req.Header.Set(middleware.HeaderDebugLog, tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.enabled, bytes.Contains(buf.Bytes(), []byte("request detail")))
+			assert.Contains(t, buf.String(), "request handled")
+
+			// Other requests keep the default level.
+			buf.Reset()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters", nil))
+			assert.NotContains(t, buf.String(), "request detail")
+		})
+	}
+}
+
+func TestDebugLog_DisabledWithoutSecret(t *testing.T) {
+	buf := captureLogs(t, "info")
+	handler := middleware.Logger(middleware.DebugLog("")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			zerolog.Ctx(r.Context()).Debug().Msg("request detail")
+		})))
+
+	req := httptest.NewRequest(http.MethodGet, "/characters", nil)
+	req.Header.Set(middleware.HeaderDebugLog, middleware.DebugLogToken("", time.Now().Add(time.Minute)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotContains(t, buf.String(), "request detail")
+}
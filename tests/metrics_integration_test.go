@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aka-project/internal"
+	"aka-project/internal/api"
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/telemetry"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	out := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			out[m.Name] = m
+		}
+	}
+	return out
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	metrics, err := middleware.NewHTTPMetrics(meter)
+	assert.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(metrics.Middleware)
+	r.Get("/characters/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "0" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	for _, path := range []string{"/characters/1", "/characters/2", "/characters/0", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	got := collectMetrics(t, reader)
+
+	counts := map[string]int64{}
+	for _, dp := range got["api.http.requests_total"].Data.(metricdata.Sum[int64]).DataPoints {
+		route, _ := dp.Attributes.Value("http.route")
+		class, _ := dp.Attributes.Value("http.status_class")
+		method, _ := dp.Attributes.Value("http.method")
+		assert.Equal(t, "GET", method.AsString())
+		counts[route.AsString()+" "+class.AsString()] += dp.Value
+	}
+	// Routes are labelled by pattern, never by the raw path.
+	assert.Equal(t, map[string]int64{
+		"/characters/{id} 2xx": 2,
+		"/characters/{id} 5xx": 1,
+		"unmatched 4xx":        1,
+	}, counts)
+
+	for _, dp := range got["api.http.request_duration_seconds"].Data.(metricdata.Histogram[float64]).DataPoints {
+		assert.Less(t, dp.Sum, 1.0, "durations are recorded in seconds")
+	}
+
+	ok := attribute.NewSet(
+		attribute.String("http.route", "/characters/{id}"),
+		attribute.String("http.method", "GET"),
+		attribute.String("http.status_class", "2xx"),
+	)
+	for _, dp := range got["api.http.response_size_bytes"].Data.(metricdata.Histogram[int64]).DataPoints {
+		if dp.Attributes.Equals(&ok) {
+			assert.Equal(t, int64(10), dp.Sum)
+		}
+	}
+
+	for _, dp := range got["api.http.requests_in_flight"].Data.(metricdata.Sum[int64]).DataPoints {
+		assert.Equal(t, int64(0), dp.Value)
+	}
+}
+
+func TestCharacterHandler_DurationInSeconds(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	handler, err := api.NewCharacterHandler(&fakeCharacterRepo{users: []db.Character{{ID: 1, Name: "Rick"}}}, meter)
+	assert.NoError(t, err)
+
+	handler.GetCharacters(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters", nil))
+
+	hist := collectMetrics(t, reader)["api.characters.request_duration_seconds"].Data.(metricdata.Histogram[float64])
+	assert.Len(t, hist.DataPoints, 1)
+	assert.Equal(t, uint64(1), hist.DataPoints[0].Count)
+	assert.Less(t, hist.DataPoints[0].Sum, 1.0)
+}
+
+func TestCharacterHandler_ErrorsLabelledByCode(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	handler, err := api.NewCharacterHandler(&fakeCharacterRepo{returnError: true}, meter)
+	assert.NoError(t, err)
+
+	handler.GetCharacters(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters?species=Human", nil))
+
+	errs := collectMetrics(t, reader)["api.characters.errors_total"].Data.(metricdata.Sum[int64])
+	if assert.Len(t, errs.DataPoints, 1) {
+		// The code, not the message, which may carry upstream URLs.
+		want := attribute.NewSet(attribute.String("error.type", internal.ErrorCodeInternal))
+		assert.True(t, errs.DataPoints[0].Attributes.Equals(&want))
+	}
+}
+
+func TestNewMeterProvider_Prometheus(t *testing.T) {
+	mp, handler, err := telemetry.NewMeterProvider(context.Background(), telemetry.MetricsPrometheus, "")
+	assert.NoError(t, err)
+	defer mp.Shutdown(context.Background())
+	assert.NotNil(t, handler)
+
+	metrics, err := middleware.NewHTTPMetrics(mp.Meter("test"))
+	assert.NoError(t, err)
+	r := chi.NewRouter()
+	r.Use(metrics.Middleware)
+	r.Get("/characters", func(w http.ResponseWriter, r *http.Request) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/characters", nil))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "api_http_requests_total{")
+	assert.Contains(t, body, `http_route="/characters"`)
+	assert.Contains(t, body, "go_goroutines ")
+	assert.Contains(t, body, "process_cpu_seconds_total ")
+	assert.False(t, strings.Contains(body, "api_http_request_duration_seconds_seconds"), "units are not suffixed twice")
+}
+
+func TestNewMeterProvider_Modes(t *testing.T) {
+	mp, handler, err := telemetry.NewMeterProvider(context.Background(), telemetry.MetricsNone, "")
+	assert.NoError(t, err)
+	assert.Nil(t, handler, "none mode serves no scrape endpoint")
+	mp.Shutdown(context.Background())
+
+	_, _, err = telemetry.NewMeterProvider(context.Background(), "statsd", "")
+	assert.ErrorContains(t, err, "unknown metrics exporter")
+
+	// OTLP metrics go to the same collector as traces.
+	_, _, err = telemetry.NewMeterProvider(context.Background(), telemetry.MetricsOTLP, "")
+	assert.ErrorContains(t, err, "needs an OTLP endpoint")
+	mp, handler, err = telemetry.NewMeterProvider(context.Background(), telemetry.MetricsOTLP, "http://localhost:4317")
+	assert.NoError(t, err)
+	assert.Nil(t, handler)
+	// Nothing listens there, so do not wait for the final export.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	mp.Shutdown(ctx)
+}
@@ -1,14 +1,25 @@
 package tests
 
 import (
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
 	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
 func TestAPIKeyAndRateLimit(t *testing.T) {
@@ -23,7 +34,8 @@ func TestAPIKeyAndRateLimit(t *testing.T) {
 
 	// Create middleware instance
 	apiKey := "secret-key"
-	mw, _ := middleware.NewMiddleware(rdb, "2-S", apiKey) // limit 2 requests
+	keys := repository.NewAPIKeyRepo(MockAPIKeys(apiKey), rdb, time.Minute)
+	mw, _ := middleware.NewMiddleware(rdb, "2-S", keys) // limit 2 requests
 
 	// Protected handler
 	handler := mw.RequireAPIKey(mw.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -70,3 +82,308 @@ func TestAPIKeyAndRateLimit(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, w.Code, "Expected status Unauthorized")
 	assert.Contains(t, w.Body.String(), "unauthorized", "Expected response body to contain 'unauthorized'")
 }
+
+func TestRequireAPIKey_RejectsUnknownAndRevokedKeys(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	queries := MockAPIKeys("live-key", "revoked-key")
+	lookup := queries.GetAPIKeyByHashFunc
+	queries.GetAPIKeyByHashFunc = func(ctx context.Context, keyHash string) (db.ApiKey, error) {
+		k, err := lookup(ctx, keyHash)
+		if k.ID == 2 {
+			k.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+		return k, err
+	}
+	keys := repository.NewAPIKeyRepo(queries, rdb, time.Minute)
+	mw, err := middleware.NewMiddleware(rdb, "10-S", keys)
+	assert.NoError(t, err)
+
+	var got *auth.Identity
+	handler := mw.RequireAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.IdentityFromContext(r.Context())
+	}))
+
+	for key, want := range map[string]int{
+		"live-key":    http.StatusOK,
+		"revoked-key": http.StatusUnauthorized,
+		"nope":        http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, key)
+	}
+
+	assert.NotNil(t, got)
+	assert.Equal(t, int64(1), got.KeyID)
+	assert.Equal(t, auth.MethodAPIKey, got.Method)
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := middleware.RequireScope(auth.ScopeCharactersWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	doReq := func(id *auth.Identity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/characters", nil)
+		if id != nil {
+			req = req.WithContext(auth.WithIdentity(req.Context(), id))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// No identity at all
+	assert.Equal(t, http.StatusUnauthorized, doReq(nil).Code)
+
+	// Read-only key gets a problem body naming the missing scope
+	w := doReq(&auth.Identity{Scopes: []string{auth.ScopeCharactersRead}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "Insufficient scope", body["title"])
+	assert.EqualValues(t, http.StatusForbidden, body["status"])
+	assert.Equal(t, []any{auth.ScopeCharactersWrite}, body["missing_scopes"])
+
+	// Direct grant and admin both pass
+	assert.Equal(t, http.StatusNoContent, doReq(&auth.Identity{Scopes: []string{auth.ScopeCharactersWrite}}).Code)
+	assert.Equal(t, http.StatusNoContent, doReq(&auth.Identity{Scopes: []string{auth.ScopeAdmin}}).Code)
+}
+
+func TestRateLimit_PlansAndRouteCosts(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	queries := MockAPIKeys("free-key", "internal-key")
+	lookup := queries.GetAPIKeyByHashFunc
+	queries.GetAPIKeyByHashFunc = func(ctx context.Context, keyHash string) (db.ApiKey, error) {
+		k, err := lookup(ctx, keyHash)
+		k.Plan = map[int64]string{1: "free", 2: "internal"}[k.ID]
+		return k, err
+	}
+	keys := repository.NewAPIKeyRepo(queries, rdb, time.Minute)
+
+	mw, err := middleware.NewMiddleware(rdb, "100-S", keys,
+		middleware.WithPlans(map[string]string{"free": "3-S", "internal": middleware.PlanUnlimited}, "free"),
+		middleware.WithRouteCosts(map[string]int64{"/characters/search": 2, "/collections/{id}": 3}),
+	)
+	assert.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(mw.RequireAPIKey)
+		r.Use(mw.RateLimit)
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		r.Get("/characters", ok)
+		r.Get("/characters/search", ok)
+		r.Get("/collections/{id}", ok)
+	})
+
+	doReq := func(key, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Free plan: 3 per second, search costs 2
+	w := doReq("free-key", "/characters/search")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = doReq("free-key", "/characters/search")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Costs are looked up by the full route pattern.
+	mr.FastForward(time.Second)
+	w = doReq("free-key", "/collections/5")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	// Internal plan is never limited
+	for i := 0; i < 10; i++ {
+		w = doReq("internal-key", "/characters/search")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	}
+}
+
+func TestNewMiddleware_RejectsInvalidPlans(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	_, err := middleware.NewMiddleware(rdb, "10-S", nil, middleware.WithPlans(map[string]string{"free": "lots"}, "free"))
+	assert.Error(t, err)
+	_, err = middleware.NewMiddleware(rdb, "10-S", nil, middleware.WithRouteCosts(map[string]int64{"/x": 0}))
+	assert.Error(t, err)
+	_, err = middleware.NewMiddleware(rdb, "10-S", nil, middleware.WithFailureMode("sometimes"))
+	assert.Error(t, err)
+}
+
+func TestRateLimit_StandardHeadersAndRetryAfter(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	keys := repository.NewAPIKeyRepo(MockAPIKeys("free-key"), rdb, time.Minute)
+	mw, err := middleware.NewMiddleware(rdb, "100-S", keys,
+		middleware.WithPlans(map[string]string{"free": "1-M"}, "free"),
+	)
+	assert.NoError(t, err)
+	handler := mw.RequireAPIKey(mw.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	doReq := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", "free-key")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doReq()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"free";q=1;w=60`, w.Header().Get("RateLimit-Policy"))
+	assert.Regexp(t, `^"free";r=0;t=\d+$`, w.Header().Get("RateLimit"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	w = doReq()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.True(t, retry >= 1 && retry <= 60, "Retry-After %d", retry)
+}
+
+func TestRateLimit_RedisDown(t *testing.T) {
+	newHandler := func(t *testing.T, mode string) (http.Handler, *sdkmetric.ManualReader) {
+		mr, err := miniredis.Run()
+		assert.NoError(t, err)
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		reader := sdkmetric.NewManualReader()
+		meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+		keys := repository.NewAPIKeyRepo(MockAPIKeys("free-key"), rdb, time.Minute)
+		mw, err := middleware.NewMiddleware(rdb, "2-M", keys,
+			middleware.WithFailureMode(mode),
+			middleware.WithMeter(meter),
+		)
+		assert.NoError(t, err)
+		handler := mw.RequireAPIKey(mw.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+		// Warm the key cache so only the limiter sees the outage.
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", "free-key")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		mr.Close()
+		return handler, reader
+	}
+	doReq := func(h http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", "free-key")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	decisions := func(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+		var rm metricdata.ResourceMetrics
+		assert.NoError(t, reader.Collect(context.Background(), &rm))
+		out := map[string]int64{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "rate_limit.fallback_decisions_total" {
+					continue
+				}
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					d, _ := dp.Attributes.Value("decision")
+					out[d.AsString()] += dp.Value
+				}
+			}
+		}
+		return out
+	}
+
+	t.Run("open", func(t *testing.T) {
+		h, reader := newHandler(t, middleware.FailOpen)
+		assert.Equal(t, http.StatusOK, doReq(h).Code)
+		assert.Equal(t, http.StatusOK, doReq(h).Code)
+		w := doReq(h)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		assert.Equal(t, map[string]int64{"allowed": 2, "throttled": 1}, decisions(t, reader))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		h, reader := newHandler(t, middleware.FailClosed)
+		w := doReq(h)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Equal(t, map[string]int64{"rejected": 1}, decisions(t, reader))
+	})
+}
+
+func TestRateLimit_DecisionMetrics(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	keys := repository.NewAPIKeyRepo(MockAPIKeys("free-key"), rdb, time.Minute)
+	mw, err := middleware.NewMiddleware(rdb, "1-M", keys,
+		middleware.WithPlans(map[string]string{"free": "1-M"}, "free"),
+		middleware.WithMeter(meter),
+	)
+	assert.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(mw.RequireAPIKey, mw.RateLimit)
+		r.Get("/characters/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	doReq := func() {
+		req := httptest.NewRequest("GET", "/characters/1", nil)
+		req.Header.Set("X-API-Key", "free-key")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	doReq()
+	doReq()
+	mr.Close()
+	doReq()
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "rate_limit.decisions_total" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				plan, _ := dp.Attributes.Value("plan")
+				route, _ := dp.Attributes.Value("http.route")
+				outcome, _ := dp.Attributes.Value("outcome")
+				got[plan.AsString()+" "+route.AsString()+" "+outcome.AsString()] += dp.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{
+		"free /characters/{id} allowed":   1,
+		"free /characters/{id} throttled": 1,
+		"free /characters/{id} error":     1,
+	}, got)
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"aka-project/internal/auth"
 	"aka-project/internal/db"
 	"aka-project/internal/helper"
 	"context"
@@ -8,6 +9,9 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 func MockFetchOK(ctx context.Context, url string) (*helper.APIResponse, error) {
@@ -35,10 +39,51 @@ func MockFetchError(ctx context.Context, url string) (*helper.APIResponse, error
 	return nil, errors.New("fetch failed")
 }
 
-// MockQueries implements only the methods we need
+// MockQueries implements only the methods we need; calling any other
+// db.Querier method panics on the nil embedded interface.
 type MockQueries struct {
+	db.Querier
 	MissingIDsFunc      func(ctx context.Context, ids []int32) ([]int32, error)
 	CreateCharacterFunc func(ctx context.Context, arg db.CreateCharacterParams) (db.Character, error)
+	GetAPIKeyByHashFunc func(ctx context.Context, keyHash string) (db.ApiKey, error)
+	TouchAPIKeyFunc     func(ctx context.Context, id int64) error
+	RevokeAPIKeyFunc    func(ctx context.Context, id int64) (db.ApiKey, error)
+	GetAPIKeyFunc       func(ctx context.Context, id int64) (db.ApiKey, error)
+	CreateAPIKeyFunc    func(ctx context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error)
+	RotateOutAPIKeyFunc func(ctx context.Context, arg db.RotateOutAPIKeyParams) (db.ApiKey, error)
+	UpsertAPIUsageFunc  func(ctx context.Context, arg db.UpsertAPIUsageParams) error
+	ListAPIUsageFunc    func(ctx context.Context, arg db.ListAPIUsageParams) ([]db.ApiUsage, error)
+	ListIPRulesFunc     func(ctx context.Context) ([]db.IpRule, error)
+
+	GetCharacterFunc            func(ctx context.Context, arg db.GetCharacterParams) (db.Character, error)
+	CreateCustomCharacterFunc   func(ctx context.Context, arg db.CreateCustomCharacterParams) (db.Character, error)
+	ListCustomCharactersFunc    func(ctx context.Context, tenant string) ([]db.Character, error)
+	DeleteCustomCharacterFunc   func(ctx context.Context, arg db.DeleteCustomCharacterParams) (int64, error)
+	GetCharacterOverrideFunc    func(ctx context.Context, arg db.GetCharacterOverrideParams) (db.CharacterOverride, error)
+	LockCharacterOverrideFunc   func(ctx context.Context, arg db.LockCharacterOverrideParams) (db.CharacterOverride, error)
+	ListCharacterOverridesFunc  func(ctx context.Context, arg db.ListCharacterOverridesParams) ([]db.CharacterOverride, error)
+	UpsertCharacterOverrideFunc func(ctx context.Context, arg db.UpsertCharacterOverrideParams) (db.CharacterOverride, error)
+	DeleteCharacterOverrideFunc func(ctx context.Context, arg db.DeleteCharacterOverrideParams) (int64, error)
+	ListCharactersByIDsFunc     func(ctx context.Context, arg db.ListCharactersByIDsParams) ([]db.Character, error)
+	ListCharactersByTagFunc     func(ctx context.Context, arg db.ListCharactersByTagParams) ([]db.Character, error)
+
+	CreateCollectionFunc       func(ctx context.Context, arg db.CreateCollectionParams) (db.Collection, error)
+	GetCollectionFunc          func(ctx context.Context, arg db.GetCollectionParams) (db.Collection, error)
+	LockCollectionFunc         func(ctx context.Context, arg db.LockCollectionParams) (db.Collection, error)
+	ListCollectionsFunc        func(ctx context.Context, arg db.ListCollectionsParams) ([]db.Collection, error)
+	UpdateCollectionFunc       func(ctx context.Context, arg db.UpdateCollectionParams) (db.Collection, error)
+	DeleteCollectionFunc       func(ctx context.Context, arg db.DeleteCollectionParams) (int64, error)
+	ListCollectionItemsFunc    func(ctx context.Context, collectionID int64) ([]db.CollectionItem, error)
+	AddCollectionItemFunc      func(ctx context.Context, arg db.AddCollectionItemParams) (db.CollectionItem, error)
+	RemoveCollectionItemFunc   func(ctx context.Context, arg db.RemoveCollectionItemParams) (int64, error)
+	ReorderCollectionItemsFunc func(ctx context.Context, arg db.ReorderCollectionItemsParams) (int64, error)
+	ReassignCollectionsFunc    func(ctx context.Context, arg db.ReassignCollectionsParams) (int64, error)
+
+	CreateUserFunc         func(ctx context.Context, arg db.CreateUserParams) (db.User, error)
+	GetUserFunc            func(ctx context.Context, arg db.GetUserParams) (db.User, error)
+	ListUserFavoritesFunc  func(ctx context.Context, userID int64) ([]db.UserFavorite, error)
+	AddUserFavoriteFunc    func(ctx context.Context, arg db.AddUserFavoriteParams) error
+	RemoveUserFavoriteFunc func(ctx context.Context, arg db.RemoveUserFavoriteParams) (int64, error)
 }
 
 func (m *MockQueries) GetMissingCharacterIDs(ctx context.Context, ids []int32) ([]int32, error) {
@@ -48,3 +93,187 @@ func (m *MockQueries) GetMissingCharacterIDs(ctx context.Context, ids []int32) (
 func (m *MockQueries) CreateCharacter(ctx context.Context, arg db.CreateCharacterParams) (db.Character, error) {
 	return m.CreateCharacterFunc(ctx, arg)
 }
+
+func (m *MockQueries) GetAPIKeyByHash(ctx context.Context, keyHash string) (db.ApiKey, error) {
+	return m.GetAPIKeyByHashFunc(ctx, keyHash)
+}
+
+func (m *MockQueries) TouchAPIKey(ctx context.Context, id int64) error {
+	if m.TouchAPIKeyFunc == nil {
+		return nil
+	}
+	return m.TouchAPIKeyFunc(ctx, id)
+}
+
+func (m *MockQueries) RevokeAPIKey(ctx context.Context, id int64) (db.ApiKey, error) {
+	return m.RevokeAPIKeyFunc(ctx, id)
+}
+
+func (m *MockQueries) GetAPIKey(ctx context.Context, id int64) (db.ApiKey, error) {
+	return m.GetAPIKeyFunc(ctx, id)
+}
+
+func (m *MockQueries) CreateAPIKey(ctx context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+	return m.CreateAPIKeyFunc(ctx, arg)
+}
+
+func (m *MockQueries) RotateOutAPIKey(ctx context.Context, arg db.RotateOutAPIKeyParams) (db.ApiKey, error) {
+	return m.RotateOutAPIKeyFunc(ctx, arg)
+}
+
+func (m *MockQueries) UpsertAPIUsage(ctx context.Context, arg db.UpsertAPIUsageParams) error {
+	return m.UpsertAPIUsageFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListAPIUsage(ctx context.Context, arg db.ListAPIUsageParams) ([]db.ApiUsage, error) {
+	if m.ListAPIUsageFunc == nil {
+		return nil, nil
+	}
+	return m.ListAPIUsageFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListIPRules(ctx context.Context) ([]db.IpRule, error) {
+	return m.ListIPRulesFunc(ctx)
+}
+
+func (m *MockQueries) GetCharacter(ctx context.Context, arg db.GetCharacterParams) (db.Character, error) {
+	return m.GetCharacterFunc(ctx, arg)
+}
+
+func (m *MockQueries) CreateCustomCharacter(ctx context.Context, arg db.CreateCustomCharacterParams) (db.Character, error) {
+	return m.CreateCustomCharacterFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListCustomCharacters(ctx context.Context, tenant string) ([]db.Character, error) {
+	if m.ListCustomCharactersFunc == nil {
+		return nil, nil
+	}
+	return m.ListCustomCharactersFunc(ctx, tenant)
+}
+
+func (m *MockQueries) DeleteCustomCharacter(ctx context.Context, arg db.DeleteCustomCharacterParams) (int64, error) {
+	return m.DeleteCustomCharacterFunc(ctx, arg)
+}
+
+func (m *MockQueries) GetCharacterOverride(ctx context.Context, arg db.GetCharacterOverrideParams) (db.CharacterOverride, error) {
+	return m.GetCharacterOverrideFunc(ctx, arg)
+}
+
+func (m *MockQueries) LockCharacterOverride(ctx context.Context, arg db.LockCharacterOverrideParams) (db.CharacterOverride, error) {
+	return m.LockCharacterOverrideFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListCharacterOverrides(ctx context.Context, arg db.ListCharacterOverridesParams) ([]db.CharacterOverride, error) {
+	if m.ListCharacterOverridesFunc == nil {
+		return nil, nil
+	}
+	return m.ListCharacterOverridesFunc(ctx, arg)
+}
+
+func (m *MockQueries) UpsertCharacterOverride(ctx context.Context, arg db.UpsertCharacterOverrideParams) (db.CharacterOverride, error) {
+	return m.UpsertCharacterOverrideFunc(ctx, arg)
+}
+
+func (m *MockQueries) DeleteCharacterOverride(ctx context.Context, arg db.DeleteCharacterOverrideParams) (int64, error) {
+	return m.DeleteCharacterOverrideFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListCharactersByIDs(ctx context.Context, arg db.ListCharactersByIDsParams) ([]db.Character, error) {
+	return m.ListCharactersByIDsFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListCharactersByTag(ctx context.Context, arg db.ListCharactersByTagParams) ([]db.Character, error) {
+	return m.ListCharactersByTagFunc(ctx, arg)
+}
+
+func (m *MockQueries) CreateCollection(ctx context.Context, arg db.CreateCollectionParams) (db.Collection, error) {
+	return m.CreateCollectionFunc(ctx, arg)
+}
+
+func (m *MockQueries) GetCollection(ctx context.Context, arg db.GetCollectionParams) (db.Collection, error) {
+	return m.GetCollectionFunc(ctx, arg)
+}
+
+func (m *MockQueries) LockCollection(ctx context.Context, arg db.LockCollectionParams) (db.Collection, error) {
+	return m.LockCollectionFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListCollections(ctx context.Context, arg db.ListCollectionsParams) ([]db.Collection, error) {
+	return m.ListCollectionsFunc(ctx, arg)
+}
+
+func (m *MockQueries) UpdateCollection(ctx context.Context, arg db.UpdateCollectionParams) (db.Collection, error) {
+	return m.UpdateCollectionFunc(ctx, arg)
+}
+
+func (m *MockQueries) DeleteCollection(ctx context.Context, arg db.DeleteCollectionParams) (int64, error) {
+	return m.DeleteCollectionFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListCollectionItems(ctx context.Context, collectionID int64) ([]db.CollectionItem, error) {
+	return m.ListCollectionItemsFunc(ctx, collectionID)
+}
+
+func (m *MockQueries) AddCollectionItem(ctx context.Context, arg db.AddCollectionItemParams) (db.CollectionItem, error) {
+	return m.AddCollectionItemFunc(ctx, arg)
+}
+
+func (m *MockQueries) RemoveCollectionItem(ctx context.Context, arg db.RemoveCollectionItemParams) (int64, error) {
+	return m.RemoveCollectionItemFunc(ctx, arg)
+}
+
+func (m *MockQueries) ReorderCollectionItems(ctx context.Context, arg db.ReorderCollectionItemsParams) (int64, error) {
+	return m.ReorderCollectionItemsFunc(ctx, arg)
+}
+
+func (m *MockQueries) ReassignCollections(ctx context.Context, arg db.ReassignCollectionsParams) (int64, error) {
+	return m.ReassignCollectionsFunc(ctx, arg)
+}
+
+func (m *MockQueries) CreateUser(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+	return m.CreateUserFunc(ctx, arg)
+}
+
+func (m *MockQueries) GetUser(ctx context.Context, arg db.GetUserParams) (db.User, error) {
+	return m.GetUserFunc(ctx, arg)
+}
+
+func (m *MockQueries) ListUserFavorites(ctx context.Context, userID int64) ([]db.UserFavorite, error) {
+	return m.ListUserFavoritesFunc(ctx, userID)
+}
+
+func (m *MockQueries) AddUserFavorite(ctx context.Context, arg db.AddUserFavoriteParams) error {
+	return m.AddUserFavoriteFunc(ctx, arg)
+}
+
+func (m *MockQueries) RemoveUserFavorite(ctx context.Context, arg db.RemoveUserFavoriteParams) (int64, error) {
+	return m.RemoveUserFavoriteFunc(ctx, arg)
+}
+
+// MockAPIKeys returns queries that know exactly the given raw keys, numbered
+// from 1 in order.
+func MockAPIKeys(raw ...string) *MockQueries {
+	keys := map[string]db.ApiKey{}
+	for i, k := range raw {
+		hash := auth.HashKey(k)
+		keys[hash] = db.ApiKey{ID: int64(i + 1), KeyHash: hash, Prefix: auth.KeyPrefix(k), Owner: "test"}
+	}
+	return &MockQueries{
+		GetAPIKeyByHashFunc: func(ctx context.Context, keyHash string) (db.ApiKey, error) {
+			if k, ok := keys[keyHash]; ok {
+				return k, nil
+			}
+			return db.ApiKey{}, pgx.ErrNoRows
+		},
+		RevokeAPIKeyFunc: func(ctx context.Context, id int64) (db.ApiKey, error) {
+			for hash, k := range keys {
+				if k.ID == id {
+					k.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+					keys[hash] = k
+					return k, nil
+				}
+			}
+			return db.ApiKey{}, pgx.ErrNoRows
+		},
+	}
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"aka-project/internal/api"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceQuota_AndUsageReport(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	keys := repository.NewAPIKeyRepo(MockAPIKeys("free-key", "other-key"), rdb, time.Minute)
+	usage := repository.NewUsageRepo(&MockQueries{}, rdb)
+	quotas := map[string]repository.Quota{"free": {Daily: 2, Monthly: 100}}
+
+	mw, err := middleware.NewMiddleware(rdb, "100-S", keys,
+		middleware.WithPlans(map[string]string{"free": "100-S"}, "free"),
+		middleware.WithQuotas(usage, quotas),
+	)
+	assert.NoError(t, err)
+	usageHandler := &api.UsageHandler{Repo: usage, Quotas: quotas, DefaultPlan: "free"}
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(mw.RequireAPIKey)
+		r.Use(mw.EnforceQuota)
+		r.Get("/characters", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	})
+	r.With(mw.RequireAPIKey).Get("/usage", usageHandler.Get)
+
+	doReq := func(key, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doReq("free-key", "/characters")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Quota-Limit-Day"))
+	assert.Equal(t, "1", w.Header().Get("X-Quota-Remaining-Day"))
+	assert.Equal(t, "99", w.Header().Get("X-Quota-Remaining-Month"))
+
+	w = doReq("free-key", "/characters")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining-Day"))
+
+	w = doReq("free-key", "/characters")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "day", w.Header().Get("X-Quota-Period"))
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.True(t, retry > 0 && retry <= 86400)
+	assert.NotEmpty(t, w.Header().Get("X-Quota-Reset"))
+
+	// Quotas are per key.
+	w = doReq("other-key", "/characters")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doReq("free-key", "/usage")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report api.UsageResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, "key:1", report.Subject)
+	assert.Equal(t, "free", report.Plan)
+	assert.Equal(t, int64(2), report.Total, "rejected calls are not counted")
+	if assert.Len(t, report.Days, 1) {
+		assert.Equal(t, time.Now().UTC().Format(time.DateOnly), report.Days[0].Date)
+		assert.Equal(t, int64(2), report.Days[0].Endpoints["GET /characters"])
+	}
+	if assert.NotNil(t, report.Quota) {
+		assert.Equal(t, int64(2), report.Quota.DailyLimit)
+		assert.Equal(t, int64(2), report.Quota.DailyUsed)
+	}
+
+	w = doReq("free-key", "/usage?from=2024-02-01&to=2024-01-01")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEnforceQuota_FailsOpen(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	keys := repository.NewAPIKeyRepo(MockAPIKeys("free-key"), rdb, time.Minute)
+	mw, err := middleware.NewMiddleware(rdb, "100-S", keys,
+		middleware.WithPlans(nil, "free"),
+		middleware.WithQuotas(repository.NewUsageRepo(&MockQueries{}, rdb), map[string]repository.Quota{"free": {Daily: 1}}),
+	)
+	assert.NoError(t, err)
+	handler := mw.RequireAPIKey(mw.EnforceQuota(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Warm the key cache, then take Redis away.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "free-key")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "1", w.Header().Get("X-Quota-Limit-Day"))
+	mr.Close()
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Quota-Limit-Day"))
+}
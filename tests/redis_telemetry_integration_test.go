@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"aka-project/internal/telemetry"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestInstrumentRedis(t *testing.T) {
+	tele, exporter := newTestTracing(t, 1)
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	assert.NoError(t, telemetry.InstrumentRedis(rdb, tele.TracerProvider, mp))
+
+	ctx, parent := tele.TracerProvider.Tracer("test").Start(context.Background(), "APIKeyRepo.GetByKey")
+	assert.NoError(t, rdb.Set(ctx, "apikey:secret-hash", "v", 0).Err())
+	assert.ErrorIs(t, rdb.Get(ctx, "missing").Err(), redis.Nil)
+	parent.End()
+
+	spans := spanNames(t, tele, exporter)
+	set, ok := spans["set"]
+	assert.True(t, ok, "commands get client spans: %v", spans)
+	assert.Equal(t, parent.SpanContext().SpanID(), set.Parent.SpanID())
+	for _, a := range set.Attributes {
+		assert.NotContains(t, a.Value.Emit(), "secret-hash", "arguments stay out of spans")
+	}
+
+	got := collectMetrics(t, reader)
+	assert.Contains(t, got, "db.client.connections.use_time")
+	assert.Contains(t, got, "db.client.connections.usage")
+}
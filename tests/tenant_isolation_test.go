@@ -0,0 +1,295 @@
+package tests
+
+import (
+	"aka-project/internal"
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+	"aka-project/internal/tenant"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTenantTestDB connects to the test database, applies the schema and
+// seeds two upstream characters. It returns two tenants of its own, whose
+// rows are removed when the test ends. Tests using it are skipped when
+// DATABASE_URL is unset.
+func newTenantTestDB(t *testing.T) (*db.Store, string, string) {
+	t.Helper()
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	pool := newTestDB(t)
+	t.Cleanup(pool.Close)
+	ctx := context.Background()
+
+	schema, err := os.ReadFile("../internal/db/schema.sql")
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, string(schema))
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `INSERT INTO characters (id, name, status, species, created)
+		VALUES (1, 'Rick', 'Alive', 'Human', now()), (2, 'Morty', 'Alive', 'Human', now())
+		ON CONFLICT (id) DO NOTHING`)
+	require.NoError(t, err)
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	a, b := "acme-"+suffix, "globex-"+suffix
+	t.Cleanup(func() {
+		for _, table := range []string{"collections", "character_overrides", "characters", "api_usage", "api_keys", "users"} {
+			if _, err := pool.Exec(ctx, "DELETE FROM "+table+" WHERE tenant = ANY($1)", []string{a, b}); err != nil {
+				t.Errorf("cleaning up %s: %v", table, err)
+			}
+		}
+	})
+	return db.NewStore(pool), a, b
+}
+
+func assertErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var appErr *internal.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, code, appErr.Code)
+	}
+}
+
+func TestTenantIsolation_RequiresTenant(t *testing.T) {
+	store := &MockQueries{}
+	characters := repository.NewCharacterRepo(store, MockFetchOK)
+	ctx := context.Background()
+
+	_, err := characters.GetCharacter(ctx, 1)
+	assertErrorCode(t, err, internal.ErrorCodeInternal)
+	_, err = characters.GetCharacters(ctx, "", "", "", "")
+	assertErrorCode(t, err, internal.ErrorCodeInternal)
+	_, err = repository.NewCollectionRepo(store, characters).List(ctx, "key:1", "")
+	assertErrorCode(t, err, internal.ErrorCodeInternal)
+	_, err = repository.NewUserRepo(store, characters).Get(ctx, 1)
+	assertErrorCode(t, err, internal.ErrorCodeInternal)
+	_, err = repository.NewUsageRepo(store, nil).Usage(ctx, "key:1", time.Now(), time.Now())
+	assertErrorCode(t, err, internal.ErrorCodeInternal)
+}
+
+func TestTenantIsolation_Overrides(t *testing.T) {
+	store, acme, globex := newTenantTestDB(t)
+	tenantA, tenantB := tenant.WithTenant(context.Background(), acme), tenant.WithTenant(context.Background(), globex)
+	repo := repository.NewCharacterRepo(store, MockFetchOK)
+
+	nickname, hidden := "Pickle Rick", true
+	_, err := repo.Patch(tenantA, 1, repository.CharacterPatch{Nickname: &nickname, Tags: &[]string{"pickle"}}, "key:1")
+	require.NoError(t, err)
+	_, err = repo.Patch(tenantA, 2, repository.CharacterPatch{Hidden: &hidden}, "key:1")
+	require.NoError(t, err)
+
+	a, err := repo.GetCharacter(tenantA, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Pickle Rick", a.Nickname)
+
+	b, err := repo.GetCharacter(tenantB, 1)
+	require.NoError(t, err)
+	assert.Empty(t, b.Nickname)
+	assert.Empty(t, b.Tags)
+
+	list, err := repo.GetCharacters(tenantB, "", "", "", "")
+	require.NoError(t, err)
+	for _, c := range list.Results {
+		assert.Empty(t, c.Nickname)
+	}
+
+	tagged, err := repo.GetCharacters(tenantB, "", "", "", "pickle")
+	require.NoError(t, err)
+	assert.Empty(t, tagged.Results)
+
+	assertErrorCode(t, repo.Delete(tenantB, 1), internal.ErrorCodeNotFound)
+	_, err = repo.GetCharacter(tenantA, 1)
+	require.NoError(t, err)
+	_, err = store.GetCharacterOverride(context.Background(), db.GetCharacterOverrideParams{Tenant: acme, CharacterID: 1})
+	assert.NoError(t, err)
+}
+
+func TestTenantIsolation_CustomCharacters(t *testing.T) {
+	store, acme, globex := newTenantTestDB(t)
+	tenantA, tenantB := tenant.WithTenant(context.Background(), acme), tenant.WithTenant(context.Background(), globex)
+	repo := repository.NewCharacterRepo(store, MockFetchOK)
+
+	created, err := repo.CreateCustom(tenantA, repository.NewCharacter{Name: "Evil Morty", Species: "Human", Status: "Alive"}, "key:1")
+	require.NoError(t, err)
+
+	_, err = repo.GetCharacter(tenantB, created.ID)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+
+	_, err = repo.Patch(tenantB, created.ID, repository.CharacterPatch{}, "key:2")
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+
+	list, err := repo.GetCharacters(tenantB, "", "", "", "")
+	require.NoError(t, err)
+	for _, c := range list.Results {
+		assert.NotEqual(t, created.ID, c.ID)
+	}
+
+	assertErrorCode(t, repo.Delete(tenantB, created.ID), internal.ErrorCodeNotFound)
+	assert.NoError(t, repo.Delete(tenantA, created.ID))
+}
+
+func TestTenantIsolation_Collections(t *testing.T) {
+	store, acme, globex := newTenantTestDB(t)
+	tenantA, tenantB := tenant.WithTenant(context.Background(), acme), tenant.WithTenant(context.Background(), globex)
+	characters := repository.NewCharacterRepo(store, MockFetchOK)
+	repo := repository.NewCollectionRepo(store, characters)
+
+	// The same owner string in two tenants must still be two owners.
+	c, err := repo.Create(tenantA, "key:1", repository.CollectionInput{Name: "villains"})
+	require.NoError(t, err)
+	assert.Equal(t, acme, c.Tenant)
+
+	_, err = repo.Get(tenantB, "key:1", c.ID)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+	_, err = repo.AddItem(tenantB, "key:1", c.ID, 1)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+	assertErrorCode(t, repo.Delete(tenantB, "key:1", c.ID), internal.ErrorCodeNotFound)
+
+	list, err := repo.List(tenantB, "key:1", "")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// Tenant B's custom characters cannot be put into tenant A's collection.
+	custom, err := characters.CreateCustom(tenantB, repository.NewCharacter{Name: "Mr. Poopybutthole"}, "key:2")
+	require.NoError(t, err)
+	_, err = repo.AddItem(tenantA, "key:1", c.ID, custom.ID)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+
+	_, err = repo.AddItem(tenantA, "key:1", c.ID, 1)
+	require.NoError(t, err)
+	got, err := repo.Get(tenantA, "key:1", c.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Items, 1)
+}
+
+func TestTenantIsolation_Users(t *testing.T) {
+	store, acme, globex := newTenantTestDB(t)
+	tenantA, tenantB := tenant.WithTenant(context.Background(), acme), tenant.WithTenant(context.Background(), globex)
+	characters := repository.NewCharacterRepo(store, MockFetchOK)
+	users := repository.NewUserRepo(store, characters)
+
+	u, err := users.Create(tenantA, "Rick", "rick@citadel.example")
+	require.NoError(t, err)
+	assert.Equal(t, acme, u.Tenant)
+	_, err = users.AddFavorite(tenantA, u.ID, 1)
+	require.NoError(t, err)
+
+	_, err = users.Get(tenantB, u.ID)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+	_, err = users.Favorites(tenantB, u.ID)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+	_, err = users.AddFavorite(tenantB, u.ID, 2)
+	assertErrorCode(t, err, internal.ErrorCodeNotFound)
+	assertErrorCode(t, users.RemoveFavorite(tenantB, u.ID, 1), internal.ErrorCodeNotFound)
+
+	favorites, err := users.Favorites(tenantA, u.ID)
+	require.NoError(t, err)
+	assert.Len(t, favorites, 1)
+
+	// Keys cannot be linked to a user of another tenant.
+	keys := repository.NewAPIKeyRepo(store, nil, time.Minute)
+	_, _, err = keys.Create(context.Background(), repository.NewAPIKey{Owner: "ops", Tenant: globex, UserID: &u.ID})
+	assertErrorCode(t, err, internal.ErrorCodeInvalidArgument)
+	key, _, err := keys.Create(context.Background(), repository.NewAPIKey{Owner: "ops", Tenant: acme, UserID: &u.ID})
+	require.NoError(t, err)
+	assert.Equal(t, acme, key.Tenant)
+}
+
+func TestTenantIsolation_Usage(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store, acme, globex := newTenantTestDB(t)
+	tenantA, tenantB := tenant.WithTenant(context.Background(), acme), tenant.WithTenant(context.Background(), globex)
+	repo := repository.NewUsageRepo(store, rdb)
+	now := time.Now()
+
+	// Both tenants have a caller called "key:1".
+	_, err = repo.Consume(tenantA, "key:1", 5, now)
+	require.NoError(t, err)
+	used, err := repo.Current(tenantB, "key:1", now)
+	require.NoError(t, err)
+	assert.Zero(t, used.Day)
+
+	repo.Record(tenantA, "key:1", "GET /characters", now)
+	repo.Record(tenantA, "key:1", "GET /characters", now)
+	repo.Record(tenantB, "key:1", "GET /characters", now)
+	require.NoError(t, repo.Rollup(context.Background(), now))
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want int64
+	}{{tenantA, 2}, {tenantB, 1}} {
+		days, err := repo.Usage(tc.ctx, "key:1", now.Add(-24*time.Hour), now)
+		require.NoError(t, err)
+		if assert.Len(t, days, 1) {
+			assert.Equal(t, tc.want, days[0].Total)
+		}
+	}
+}
+
+func TestTenantIsolation_Middleware(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mw, err := middleware.NewMiddleware(rdb, "1-M", nil)
+	require.NoError(t, err)
+
+	// Callers with the same subject in different tenants.
+	sameSubject := middleware.AuthenticatorFunc(func(r *http.Request) (*auth.Identity, error) {
+		return &auth.Identity{Method: auth.MethodJWT, Subject: "svc", Tenant: r.Header.Get("X-Test-Tenant")}, nil
+	})
+	var seen []string
+	handler := middleware.RequireAuth(sameSubject)(mw.RateLimit(middleware.Idempotency(rdb, time.Hour)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := tenant.FromContext(r.Context())
+			seen = append(seen, id)
+			zerolog.Ctx(r.Context()).Info().Msg("handled")
+			w.WriteHeader(http.StatusCreated)
+		}))))
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	do := func(tenantID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader("{}"))
+		req.Header.Set("X-Test-Tenant", tenantID)
+		req.Header.Set(middleware.HeaderIdempotencyKey, "same-key")
+		req = req.WithContext(logger.WithContext(req.Context()))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusCreated, do("acme"))
+	// Neither the rate-limit bucket nor the idempotency record of acme
+	// applies to globex.
+	assert.Equal(t, http.StatusCreated, do("globex"))
+	assert.Equal(t, http.StatusTooManyRequests, do("acme"))
+	assert.Equal(t, []string{"acme", "globex"}, seen)
+
+	assert.Contains(t, logs.String(), `"tenant":"acme"`)
+	assert.Contains(t, logs.String(), `"tenant":"globex"`)
+
+	// Identities that name no tenant act for the default one.
+	assert.Equal(t, http.StatusCreated, do(""))
+	assert.Equal(t, tenant.Default, seen[len(seen)-1])
+}
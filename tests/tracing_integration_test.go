@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/repository"
+	"aka-project/internal/telemetry"
+	"aka-project/internal/tenant"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func newTestTracing(t *testing.T, ratio float64) (*telemetry.Telemetry, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tele, err := telemetry.NewTelemetry("test", telemetry.WithSpanExporter(exporter), telemetry.WithSampleRatio(ratio))
+	assert.NoError(t, err)
+	t.Cleanup(func() { tele.Shutdown(context.Background()) })
+	return tele, exporter
+}
+
+func spanNames(t *testing.T, tele *telemetry.Telemetry, exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	t.Helper()
+	assert.NoError(t, tele.TracerProvider.ForceFlush(context.Background()))
+	out := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		out[s.Name] = s
+	}
+	return out
+}
+
+func TestTracing_ServerSpans(t *testing.T) {
+	// Nothing is sampled unless the caller sampled the trace.
+	tele, exporter := newTestTracing(t, 0)
+
+	var logs bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&logs)
+	t.Cleanup(func() { log.Logger = saved })
+
+	repo := repository.NewCharacterRepo(&MockQueries{
+		GetCharacterFunc: func(ctx context.Context, arg db.GetCharacterParams) (db.Character, error) {
+			return db.Character{ID: arg.ID, Name: "Rick"}, nil
+		},
+	}, MockFetchOK)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Tracing, middleware.Logger)
+	r.Get("/characters/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := tenant.WithTenant(r.Context(), tenant.Default)
+		_, err := repo.GetCharacter(ctx, 1)
+		assert.NoError(t, err)
+	})
+	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(path, traceparent string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if traceparent != "" {
+			req.Header.Set("traceparent", traceparent)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	do("/characters/1", "")
+	assert.Empty(t, spanNames(t, tele, exporter), "unsampled root traces are dropped")
+
+	do("/readyz", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	do("/characters/1", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	spans := spanNames(t, tele, exporter)
+
+	server, ok := spans["GET /characters/{id}"]
+	assert.True(t, ok, "server span is named after the route pattern: %v", spans)
+	assert.Equal(t, parentTraceID, server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+
+	child, ok := spans["CharacterRepo.GetCharacter"]
+	assert.True(t, ok, "repository calls get child spans: %v", spans)
+	assert.Equal(t, server.SpanContext.SpanID(), child.Parent.SpanID())
+
+	_, ok = spans["GET /readyz"]
+	assert.False(t, ok, "probes are not traced")
+
+	assert.Contains(t, logs.String(), `"trace_id":"`+parentTraceID+`"`)
+}
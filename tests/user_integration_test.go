@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aka-project/internal"
+	"aka-project/internal/api"
+	"aka-project/internal/auth"
+	"aka-project/internal/db"
+	"aka-project/internal/middleware"
+	"aka-project/internal/models"
+	"aka-project/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUsersRepo implements api.UsersRepo in memory.
+type fakeUsersRepo struct {
+	users     []models.User
+	favorites map[int64][]int32
+}
+
+func (f *fakeUsersRepo) Create(ctx context.Context, name, email string) (models.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return models.User{}, internal.NewError(internal.ErrorCodeConflict, "a user with this email already exists")
+		}
+	}
+	u := models.User{ID: int64(len(f.users) + 1), Name: name, Email: email, CreatedAt: "2026-01-01T00:00:00Z"}
+	f.users = append(f.users, u)
+	return u, nil
+}
+
+func (f *fakeUsersRepo) Get(ctx context.Context, id int64) (models.User, error) {
+	if id < 1 || id > int64(len(f.users)) {
+		return models.User{}, internal.NewError(internal.ErrorCodeNotFound, "user not found")
+	}
+	return f.users[id-1], nil
+}
+
+func (f *fakeUsersRepo) Favorites(ctx context.Context, userID int64) ([]repository.Character, error) {
+	out := []repository.Character{}
+	for _, id := range f.favorites[userID] {
+		out = append(out, repository.Character{Character: db.Character{ID: id}})
+	}
+	return out, nil
+}
+
+func (f *fakeUsersRepo) AddFavorite(ctx context.Context, userID int64, characterID int32) (repository.Character, error) {
+	if f.favorites == nil {
+		f.favorites = map[int64][]int32{}
+	}
+	f.favorites[userID] = append(f.favorites[userID], characterID)
+	return repository.Character{Character: db.Character{ID: characterID}}, nil
+}
+
+func (f *fakeUsersRepo) RemoveFavorite(ctx context.Context, userID int64, characterID int32) error {
+	return internal.NewError(internal.ErrorCodeNotFound, "character is not a favorite")
+}
+
+// newUserRouter authenticates every request as an API key linked to the
+// user named in X-Test-User, with the comma-separated scopes in
+// X-Test-Scope. Routes require scopes as in cmd/api.
+func newUserRouter(repo api.UsersRepo) http.Handler {
+	h := &api.UserHandler{Repo: repo}
+	r := chi.NewRouter()
+	r.Post("/admin/users", h.Create)
+	r.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id := &auth.Identity{Method: auth.MethodAPIKey, KeyID: 9, Scopes: strings.Split(r.Header.Get("X-Test-Scope"), ",")}
+				if r.Header.Get("X-Test-User") == "1" {
+					id.UserID = 1
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+			})
+		})
+		r.With(middleware.RequireScope(auth.ScopeCharactersRead)).Get("/users/{id}", h.Get)
+		r.With(middleware.RequireScope(auth.ScopeCharactersRead)).Get("/users/{id}/favorites", h.ListFavorites)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(auth.ScopeCharactersWrite))
+			r.Put("/users/{id}/favorites/{characterID}", h.AddFavorite)
+			r.Delete("/users/{id}/favorites/{characterID}", h.RemoveFavorite)
+		})
+	})
+	return r
+}
+
+func TestUserHandler_CreateAndFavorites(t *testing.T) {
+	router := newUserRouter(&fakeUsersRepo{})
+
+	do := func(method, path, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Test-User", user)
+		req.Header.Set("X-Test-Scope", auth.ScopeCharactersRead+","+auth.ScopeCharactersWrite)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/admin/users", `{"name":"Rick","email":"Rick@Citadel.example"}`, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var user models.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, int64(1), user.ID)
+	assert.Equal(t, "rick@citadel.example", user.Email)
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users", `{"name":"Rick","email":"rick@citadel.example"}`, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/users", `{"name":"Rick","email":"not-an-email"}`, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/users", `{"email":"morty@citadel.example"}`, "").Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/users/1/favorites/7", "", "1").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/users/me/favorites/8", "", "1").Code)
+
+	w = do(http.MethodGet, "/users/me/favorites", "", "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var favorites []repository.Character
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &favorites))
+	if assert.Len(t, favorites, 2) {
+		assert.Equal(t, int32(7), favorites[0].ID)
+	}
+
+	w = do(http.MethodGet, "/users/me", "", "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Rick"`)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/users/1/favorites/99", "", "1").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/users/1/favorites/abc", "", "1").Code)
+}
+
+func TestUserHandler_OnlyActsForLinkedUser(t *testing.T) {
+	repo := &fakeUsersRepo{}
+	_, _ = repo.Create(context.Background(), "Rick", "rick@citadel.example")
+	_, _ = repo.Create(context.Background(), "Morty", "morty@citadel.example")
+	router := newUserRouter(repo)
+
+	do := func(method, path, user, scope string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Test-User", user)
+		req.Header.Set("X-Test-Scope", scope)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A key linked to user 1 cannot read or change user 2's favorites.
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/users/2/favorites", "1", auth.ScopeCharactersRead))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/users/2/favorites/7", "1", auth.ScopeCharactersWrite))
+	// Read-only keys cannot change even their own user's favorites.
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/users/1/favorites/7", "1", auth.ScopeCharactersRead))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/users/1/favorites/7", "1", auth.ScopeCharactersRead))
+	// Unlinked keys have no "me".
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/users/me", "", auth.ScopeCharactersRead))
+	// Admins may act on any user.
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/users/2/favorites", "", auth.ScopeAdmin))
+}